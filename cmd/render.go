@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"os"
 
@@ -22,6 +24,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var legacyIDs bool
+
 // renderCmd represents the render command
 var renderCmd = &cobra.Command{
 	Use:   "render",
@@ -34,14 +38,23 @@ var renderCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(renderCmd)
+	renderCmd.Flags().BoolVar(&legacyIDs, "legacy-ids", false, "Render hyphenated node ids (type-namespace-name) instead of type/namespace/name")
 }
 
 func render() {
 	kubeconfig := rootCmd.Flag("kubeconfig").Value.String()
-	data, err := renderer.GetGraph(kubeconfig)
+	graph, err := renderer.BuildGraph(context.Background(), rendererOptions(kubeconfig))
 	if err != nil {
 		fmt.Printf("failed to render cluster graph: %s", err)
 		os.Exit(1)
 	}
+	if legacyIDs {
+		renderer.UseLegacyIDs(graph)
+	}
+	data, err := json.MarshalIndent(graph, "", "	")
+	if err != nil {
+		fmt.Printf("failed to encode cluster graph: %s", err)
+		os.Exit(1)
+	}
 	fmt.Printf("%s\n", data)
 }
@@ -17,7 +17,9 @@ package cmd
 import (
 	"fmt"
 	"os"
+	"time"
 
+	renderer "github.com/afritzler/kube-universe/pkg/renderer"
 	homedir "github.com/mitchellh/go-homedir"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -50,6 +52,43 @@ func init() {
 	if err := viper.BindPFlag("kubeconfig", rootCmd.PersistentFlags().Lookup("kubeconfig")); err != nil {
 		panic(fmt.Sprintf("faild to bind kubeconfig flag: %s", err))
 	}
+	rootCmd.PersistentFlags().StringSlice("collectors", nil, fmt.Sprintf("(optional) only collect these resources, one of %v", renderer.CollectorNames()))
+	if err := viper.BindPFlag("collectors", rootCmd.PersistentFlags().Lookup("collectors")); err != nil {
+		panic(fmt.Sprintf("faild to bind collectors flag: %s", err))
+	}
+	rootCmd.PersistentFlags().StringSlice("disable-collectors", nil, "(optional) resources to leave out of the graph")
+	if err := viper.BindPFlag("disable-collectors", rootCmd.PersistentFlags().Lookup("disable-collectors")); err != nil {
+		panic(fmt.Sprintf("faild to bind disable-collectors flag: %s", err))
+	}
+	rootCmd.PersistentFlags().Duration("metrics-interval", 30*time.Second, "Interval for polling pod and node usage from metrics-server (0 disables metrics)")
+	if err := viper.BindPFlag("metrics-interval", rootCmd.PersistentFlags().Lookup("metrics-interval")); err != nil {
+		panic(fmt.Sprintf("faild to bind metrics-interval flag: %s", err))
+	}
+}
+
+// rendererOptions returns the renderer options from flags and the config file
+func rendererOptions(kubeconfig string) renderer.Options {
+	// Custom resources can only be listed in the config file, e.g.
+	//
+	//	custom-resources:
+	//	  - group: argoproj.io
+	//	    version: v1alpha1
+	//	    resource: rollouts
+	//	    status: .status.phase
+	//	    resourceinfo:
+	//	      replicas: .status.replicas
+	var customResources []renderer.CustomResource
+	if err := viper.UnmarshalKey("custom-resources", &customResources); err != nil {
+		panic(fmt.Sprintf("failed to read custom-resources config: %s", err))
+	}
+
+	return renderer.Options{
+		Kubeconfig:         kubeconfig,
+		Collectors:         viper.GetStringSlice("collectors"),
+		DisabledCollectors: viper.GetStringSlice("disable-collectors"),
+		CustomResources:    customResources,
+		MetricsInterval:    viper.GetDuration("metrics-interval"),
+	}
 }
 
 // initConfig reads in config file and ENV variables if set.
@@ -15,10 +15,15 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	renderer "github.com/afritzler/kube-universe/pkg/renderer"
 	"github.com/afritzler/kube-universe/pkg/websocket"
@@ -28,6 +33,11 @@ import (
 )
 
 var port string
+var coalesceWindow time.Duration
+var pollInterval time.Duration
+var ignoredFields []string
+var ignoredMaxHold time.Duration
+var historySize int
 
 // serveCmd represents the serve command
 var serveCmd = &cobra.Command{
@@ -48,36 +58,92 @@ func init() {
 	if err := viper.BindPFlag("port", serveCmd.PersistentFlags().Lookup("port")); err != nil {
 		panic(fmt.Sprintf("faild to bind port flag: %s", err))
 	}
+	serveCmd.PersistentFlags().DurationVar(&coalesceWindow, "coalesce-window", 250*time.Millisecond, "How long to collect cluster changes before pushing an update")
+	if err := viper.BindPFlag("coalesce-window", serveCmd.PersistentFlags().Lookup("coalesce-window")); err != nil {
+		panic(fmt.Sprintf("faild to bind coalesce-window flag: %s", err))
+	}
+	serveCmd.PersistentFlags().DurationVar(&pollInterval, "poll-interval", 30*time.Second, "Interval for rebuilding the graph without change events (0 disables polling)")
+	if err := viper.BindPFlag("poll-interval", serveCmd.PersistentFlags().Lookup("poll-interval")); err != nil {
+		panic(fmt.Sprintf("faild to bind poll-interval flag: %s", err))
+	}
+	serveCmd.PersistentFlags().StringSliceVar(&ignoredFields, "delta-ignore-fields", nil,
+		"Node fields whose changes alone don't push an update, e.g. statusmessage or resourceinfo.restart_count. A trailing * matches keys by prefix")
+	if err := viper.BindPFlag("delta-ignore-fields", serveCmd.PersistentFlags().Lookup("delta-ignore-fields")); err != nil {
+		panic(fmt.Sprintf("faild to bind delta-ignore-fields flag: %s", err))
+	}
+	serveCmd.PersistentFlags().DurationVar(&ignoredMaxHold, "delta-ignore-max-hold", time.Minute, "How long changes to ignored fields alone are held back before they are pushed anyway (0 holds them until another change is pushed)")
+	if err := viper.BindPFlag("delta-ignore-max-hold", serveCmd.PersistentFlags().Lookup("delta-ignore-max-hold")); err != nil {
+		panic(fmt.Sprintf("faild to bind delta-ignore-max-hold flag: %s", err))
+	}
+	serveCmd.PersistentFlags().IntVar(&historySize, "delta-history", 100, "Number of recent updates kept for clients resuming after a reconnect")
+	if err := viper.BindPFlag("delta-history", serveCmd.PersistentFlags().Lookup("delta-history")); err != nil {
+		panic(fmt.Sprintf("faild to bind delta-history flag: %s", err))
+	}
 }
 
 func serve() {
 	fmt.Printf("started server on http://localhost:%s\n", port)
 
+	// Shut down cleanly on Ctrl-C and when the pod is terminated
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	config := os.Getenv("KUBECONFIG")
 	if config == "" {
 		config = rootCmd.Flag("kubeconfig").Value.String()
 	}
 
+	// Keep a watch-backed copy of the cluster so graph builds don't hit the API server
+	cache, err := renderer.NewCache(rendererOptions(config))
+	if err != nil {
+		panic(fmt.Sprintf("failed to create cluster cache: %s", err))
+	}
+	if err := cache.Start(ctx); err != nil {
+		panic(fmt.Sprintf("failed to start cluster cache: %s", err))
+	}
+
 	// Create and start websocket hub
-	hub := websocket.NewHub(config)
+	hub := websocket.NewHub(cache, websocket.HubConfig{
+		CoalesceWindow:       coalesceWindow,
+		PollInterval:         pollInterval,
+		IgnoredFields:        ignoredFields,
+		IgnoredFieldsMaxHold: ignoredMaxHold,
+		HistorySize:          historySize,
+	})
 	go hub.Run()
 
 	http.Handle("/", http.FileServerFS(web.WebFiles))
 
 	// Keep the original /graph endpoint for backward compatibility
 	http.HandleFunc("/graph", func(writer http.ResponseWriter, request *http.Request) {
-		data, err := renderer.GetGraph(config)
-		if err != nil {
-			fmt.Printf("failed to render landscape graph: %s", err)
-			http.Error(writer, err.Error(), http.StatusInternalServerError)
-			fmt.Printf("failed to render graph: %s", err)
+		graph := cache.BuildGraph()
+		// Consumers of the hyphenated ids can keep them while they migrate
+		if request.URL.Query().Get("ids") == "legacy" {
+			renderer.UseLegacyIDs(graph)
 		}
 		writer.Header().Set("Content-Type", "application/json")
-		if _, err := writer.Write(data); err != nil {
+		encoder := json.NewEncoder(writer)
+		encoder.SetIndent("", "	")
+		if err := encoder.Encode(graph); err != nil {
 			fmt.Printf("faild to write response data: %s", err)
 		}
 	})
 
+	// Full details of a node, the websocket only sends slim nodes
+	http.HandleFunc("/nodes/", func(writer http.ResponseWriter, request *http.Request) {
+		// Ids contain slashes and escaped segments, match them as sent
+		id := strings.TrimPrefix(request.URL.EscapedPath(), "/nodes/")
+		node := hub.NodeDetails(id)
+		if node == nil {
+			http.Error(writer, fmt.Sprintf("node %q not found", id), http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(writer).Encode(node); err != nil {
+			fmt.Printf("failed to write node details: %s", err)
+		}
+	})
+
 	// Add websocket endpoint
 	http.HandleFunc("/ws", hub.HandleWebSocket)
 
@@ -90,9 +156,28 @@ func serve() {
 		}
 	})
 
-	if err := http.ListenAndServe(getPort(), nil); err != nil {
+	server := &http.Server{Addr: getPort()}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		// Websocket connections are hijacked, the server doesn't close them
+		if err := hub.Stop(shutdownCtx); err != nil {
+			fmt.Printf("failed to stop websocket hub: %s\n", err)
+		}
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			fmt.Printf("failed to shut down server: %s\n", err)
+		}
+	}()
+
+	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		panic(fmt.Sprintf("faild to start server: %s", err))
 	}
+	// ListenAndServe returns as soon as Shutdown starts, wait for it to finish
+	<-stopped
+	cache.Shutdown()
 }
 
 func getPort() string {
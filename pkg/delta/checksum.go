@@ -0,0 +1,67 @@
+package delta
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+// The checksum of a graph lets clients verify that applying updates left them
+// with the same graph as the server. Every node and link is hashed on its own
+// as canonical JSON, i.e. with object keys sorted, no HTML escaping and
+// numbers formatted like JavaScript does. The checksum hashes the sorted
+// node and link hashes, so it doesn't depend on the order of either.
+
+// digest returns the hex SHA-256 of the canonical JSON of v
+func digest(v interface{}) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	// Clients only see what survives a JSON round trip, e.g. all numbers
+	// are float64, so hash that
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(generic); err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(bytes.TrimSuffix(buf.Bytes(), []byte("\n")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// checksum combines the node and link digests into the graph checksum
+func checksum(nodeDigests map[string]string, linkDigests map[linkKey]string) string {
+	nodes := make([]string, 0, len(nodeDigests))
+	for _, d := range nodeDigests {
+		nodes = append(nodes, d)
+	}
+	links := make([]string, 0, len(linkDigests))
+	for _, d := range linkDigests {
+		links = append(links, d)
+	}
+	sort.Strings(nodes)
+	sort.Strings(links)
+
+	var b strings.Builder
+	b.WriteString("nodes\n")
+	for _, d := range nodes {
+		b.WriteString(d)
+		b.WriteString("\n")
+	}
+	b.WriteString("links\n")
+	for _, d := range links {
+		b.WriteString(d)
+		b.WriteString("\n")
+	}
+	sum := sha256.Sum256([]byte(b.String()))
+	return hex.EncodeToString(sum[:])
+}
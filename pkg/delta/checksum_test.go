@@ -0,0 +1,214 @@
+package delta
+
+import (
+	"testing"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// testGraph returns the same graph for every call. With reversed set the
+// nodes, links and map entries are added in the opposite order.
+func testGraph(reversed bool) *kutype.Graph {
+	type entry struct {
+		key   string
+		value interface{}
+	}
+	info := []entry{
+		{"phase", "Running"},
+		{"restart_count", 3},
+		{"cpu_requests_millicores", int64(250)},
+		{"containers", []string{"app", "sidecar"}},
+		{"container_resources", []map[string]interface{}{{"name": "app", "type": "container", "cpu_requests": "250m"}}},
+		{"nested", map[string]interface{}{"b": 2, "a": map[string]interface{}{"y": "<y>", "x": "&x"}}},
+	}
+	labels := []entry{{"app", "web"}, {"tier", "frontend"}, {"version", "v1"}}
+
+	nodes := []kutype.Node{
+		{Id: "namespace/default", Name: "default", Type: "namespace"},
+		{Id: "pod/default/web-0", Name: "web-0", Type: "pod", Namespace: "default", Status: "Running"},
+		{Id: "configmap/default/web", Name: "web", Type: "configmap", Namespace: "default"},
+	}
+	links := []kutype.Link{
+		{Source: "namespace/default", Target: "pod/default/web-0", Value: 1, Relationship: "contains"},
+		{Source: "namespace/default", Target: "configmap/default/web", Value: 1, Relationship: "contains"},
+		{Source: "configmap/default/web", Target: "pod/default/web-0", Value: 1, Relationship: "depends_on",
+			Consumption: []string{"env"}, Keys: []string{"LOG_LEVEL"}},
+	}
+
+	if reversed {
+		reverse(info)
+		reverse(labels)
+		reverse(nodes)
+		reverse(links)
+	}
+
+	resourceInfo := make(map[string]interface{})
+	for _, e := range info {
+		resourceInfo[e.key] = e.value
+	}
+	podLabels := make(map[string]string)
+	for _, e := range labels {
+		podLabels[e.key] = e.value.(string)
+	}
+	for i := range nodes {
+		if nodes[i].Type == "pod" {
+			nodes[i].ResourceInfo = resourceInfo
+			nodes[i].Labels = podLabels
+		}
+	}
+	return &kutype.Graph{Nodes: &nodes, Links: &links}
+}
+
+func reverse[T any](s []T) {
+	for i, j := 0, len(s)-1; i < j; i, j = i+1, j-1 {
+		s[i], s[j] = s[j], s[i]
+	}
+}
+
+func TestDigestIgnoresMapOrder(t *testing.T) {
+	pod := (*testGraph(false).Nodes)[1]
+	reversedPod := (*testGraph(true).Nodes)[1]
+	if pod.Id != reversedPod.Id {
+		t.Fatalf("test graphs don't line up: %s and %s", pod.Id, reversedPod.Id)
+	}
+
+	want, err := digest(pod)
+	if err != nil {
+		t.Fatalf("digest failed: %s", err)
+	}
+	// Map iteration order is random, digest many times to give it a chance
+	// to differ
+	for i := 0; i < 100; i++ {
+		for _, node := range []kutype.Node{pod, reversedPod} {
+			got, err := digest(node)
+			if err != nil {
+				t.Fatalf("digest failed: %s", err)
+			}
+			if got != want {
+				t.Fatalf("digest = %s, want %s", got, want)
+			}
+		}
+	}
+}
+
+func TestDigestMatchesJSONRoundTrip(t *testing.T) {
+	// Clients only see float64 numbers, hashes must not depend on Go types
+	typed := kutype.Node{Id: "pod/default/web-0", ResourceInfo: map[string]interface{}{
+		"restart_count": int32(3), "cpu_requests_millicores": int64(250), "containers": []string{"app"},
+	}}
+	decoded := kutype.Node{Id: "pod/default/web-0", ResourceInfo: map[string]interface{}{
+		"restart_count": float64(3), "cpu_requests_millicores": float64(250), "containers": []interface{}{"app"},
+	}}
+	typedDigest, err := digest(typed)
+	if err != nil {
+		t.Fatalf("digest failed: %s", err)
+	}
+	decodedDigest, err := digest(decoded)
+	if err != nil {
+		t.Fatalf("digest failed: %s", err)
+	}
+	if typedDigest != decodedDigest {
+		t.Errorf("digest of typed node %s differs from decoded node %s", typedDigest, decodedDigest)
+	}
+}
+
+func TestChecksumIgnoresOrder(t *testing.T) {
+	first, err := NewDeltaTracker().GenerateDelta(testGraph(false))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	second, err := NewDeltaTracker().GenerateDelta(testGraph(true))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if first.Checksum == "" {
+		t.Fatalf("full update has no checksum")
+	}
+	if first.Checksum != second.Checksum {
+		t.Errorf("checksums of the same graph in different orders differ: %s and %s", first.Checksum, second.Checksum)
+	}
+}
+
+func TestChecksumChangesWithGraph(t *testing.T) {
+	graph := testGraph(false)
+	before, err := NewDeltaTracker().GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+
+	(*graph.Nodes)[1].Status = "Failed"
+	after, err := NewDeltaTracker().GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if before.Checksum == after.Checksum {
+		t.Errorf("checksum didn't change with a node")
+	}
+
+	// Links with the same ends but another relationship are different links
+	links := append(*graph.Links, kutype.Link{Source: "namespace/default", Target: "pod/default/web-0", Value: 1, Relationship: "manages"})
+	graph.Links = &links
+	withLink, err := NewDeltaTracker().GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if withLink.Checksum == after.Checksum {
+		t.Errorf("checksum didn't change with a link")
+	}
+}
+
+func TestDeltaAndSnapshotChecksumsMatch(t *testing.T) {
+	dt := NewDeltaTracker()
+	full, err := dt.GenerateDelta(testGraph(false))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if snapshot := dt.Snapshot(); snapshot.Checksum != full.Checksum || snapshot.Revision != full.Revision {
+		t.Errorf("snapshot at revision %d has checksum %s, full update at revision %d has %s",
+			snapshot.Revision, snapshot.Checksum, full.Revision, full.Checksum)
+	}
+
+	// Rebuild the graph in the other order with a changed pod and a new link
+	graph := testGraph(true)
+	for i := range *graph.Nodes {
+		if (*graph.Nodes)[i].Type == "pod" {
+			(*graph.Nodes)[i].Status = "CrashLoopBackOff"
+		}
+	}
+	links := append(*graph.Links, kutype.Link{Source: "pod/default/web-0", Target: "namespace/default", Value: 1, Relationship: "runs"})
+	graph.Links = &links
+
+	update, err := dt.GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update == nil || update.Type != "delta" {
+		t.Fatalf("expected a delta, got %+v", update)
+	}
+	snapshot := dt.Snapshot()
+	if snapshot.Checksum != update.Checksum || snapshot.Revision != update.Revision {
+		t.Errorf("snapshot at revision %d has checksum %s, delta at revision %d has %s",
+			snapshot.Revision, snapshot.Checksum, update.Revision, update.Checksum)
+	}
+
+	// A client starting from the new graph must arrive at the same checksum
+	fresh, err := NewDeltaTracker().GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if fresh.Checksum != update.Checksum {
+		t.Errorf("delta checksum %s differs from the checksum of the graph it leads to %s", update.Checksum, fresh.Checksum)
+	}
+
+	// Without changes there is no update and the snapshot stays the same
+	unchanged, err := dt.GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if unchanged != nil {
+		t.Errorf("expected no update for an unchanged graph, got %+v", unchanged)
+	}
+	if again := dt.Snapshot(); again.Checksum != update.Checksum {
+		t.Errorf("snapshot checksum changed from %s to %s without changes", update.Checksum, again.Checksum)
+	}
+}
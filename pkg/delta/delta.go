@@ -5,37 +5,150 @@ import (
 	"fmt"
 	"log"
 	"reflect"
+	"strconv"
+	"strings"
+	"time"
 
 	kutype "github.com/afritzler/kube-universe/pkg/types"
 )
 
 // DeltaUpdate represents a delta update message
 type DeltaUpdate struct {
-	Type         string        `json:"type"`
+	Type string `json:"type"`
+	// Epoch identifies the tracker that numbered the revisions, a new epoch
+	// means revisions started over, e.g. after a server restart
+	Epoch string `json:"epoch"`
+	// Revision is the revision of the graph after applying the update
+	Revision uint64 `json:"revision"`
+	// BaseRevision is the revision a delta applies to, zero for full updates
+	BaseRevision uint64 `json:"base_revision,omitempty"`
+	// Checksum is the checksum of the graph after applying the update
+	Checksum     string        `json:"checksum"`
 	Nodes        []kutype.Node `json:"nodes,omitempty"`
+	NodePatches  []NodePatch   `json:"node_patches,omitempty"`
 	Links        []kutype.Link `json:"links,omitempty"`
+	UpdatedLinks []kutype.Link `json:"updated_links,omitempty"`
 	RemovedNodes []string      `json:"removed_nodes,omitempty"`
 	RemovedLinks []LinkRef     `json:"removed_links,omitempty"`
 }
 
 // LinkRef represents a link reference for removal
 type LinkRef struct {
-	Source string `json:"source"`
-	Target string `json:"target"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	Relationship string `json:"relationship,omitempty"`
+}
+
+// linkKey identifies a link by its ends and relationship, so a pair of nodes
+// can be connected by several links. A struct key stays unambiguous no matter
+// which characters the node ids contain.
+type linkKey struct {
+	source       string
+	target       string
+	relationship string
+}
+
+// keyOf returns the key a link is tracked under
+func keyOf(link kutype.Link) linkKey {
+	return linkKey{source: link.Source, target: link.Target, relationship: link.Relationship}
 }
 
 // DeltaTracker tracks changes between graph states
 type DeltaTracker struct {
 	previousNodes map[string]kutype.Node
-	previousLinks map[string]kutype.Link
+	previousLinks map[linkKey]kutype.Link
+	ignored       ignoredFields
+	epoch         string
+	// revision counts the updates generated so far
+	revision uint64
+	// nodeDigests and linkDigests hash each tracked node and link, they are
+	// combined into the checksum of the tracked graph
+	nodeDigests map[string]string
+	linkDigests map[linkKey]string
+	checksum    string
+	// snapshot and snapshotJSON cache the full update of the tracked graph,
+	// they are dropped when the tracked graph changes
+	snapshot     *DeltaUpdate
+	snapshotJSON []byte
+	// maxHold is how long nodes whose ignored fields alone changed are held
+	// back, heldSince is when the oldest of the held back nodes changed
+	maxHold   time.Duration
+	heldSince time.Time
+}
+
+// ignoredFields are the node fields left out when comparing nodes
+type ignoredFields struct {
+	// fields holds top-level fields by their JSON name, e.g. status
+	fields map[string]bool
+	// keys holds single keys of the labels, annotations and resourceinfo maps
+	keys map[string]*keySet
+}
+
+// keySet matches map keys exactly, or by prefix for entries ending in *
+type keySet struct {
+	exact    map[string]bool
+	prefixes []string
+}
+
+func (ks *keySet) add(key string) {
+	if prefix, ok := strings.CutSuffix(key, "*"); ok {
+		ks.prefixes = append(ks.prefixes, prefix)
+		return
+	}
+	ks.exact[key] = true
+}
+
+// has reports whether key is in the set, a nil set is empty
+func (ks *keySet) has(key string) bool {
+	if ks == nil {
+		return false
+	}
+	if ks.exact[key] {
+		return true
+	}
+	for _, prefix := range ks.prefixes {
+		if strings.HasPrefix(key, prefix) {
+			return true
+		}
+	}
+	return false
 }
 
-// NewDeltaTracker creates a new delta tracker
-func NewDeltaTracker() *DeltaTracker {
-	return &DeltaTracker{
+// NewDeltaTracker creates a new delta tracker. Changes to the ignored fields
+// alone don't produce an update, the node is held back and sent with the next
+// update instead, see SetMaxHold. Fields are named by their JSON
+// name, e.g. statusmessage, or for single keys of the labels, annotations and
+// resourceinfo maps as map.key, e.g. resourceinfo.phase. A key ending in *
+// matches all keys with that prefix, e.g. resourceinfo.cpu_usage* covers
+// cpu_usage, cpu_usage_millicores and the usage percentages.
+func NewDeltaTracker(ignoredFields ...string) *DeltaTracker {
+	dt := &DeltaTracker{
 		previousNodes: make(map[string]kutype.Node),
-		previousLinks: make(map[string]kutype.Link),
+		previousLinks: make(map[linkKey]kutype.Link),
+		nodeDigests:   make(map[string]string),
+		linkDigests:   make(map[linkKey]string),
+		epoch:         strconv.FormatInt(time.Now().UnixNano(), 36),
 	}
+	dt.ignored.fields = make(map[string]bool)
+	dt.ignored.keys = make(map[string]*keySet)
+	for _, field := range ignoredFields {
+		if m, key, nested := strings.Cut(field, "."); nested {
+			if dt.ignored.keys[m] == nil {
+				dt.ignored.keys[m] = &keySet{exact: make(map[string]bool)}
+			}
+			dt.ignored.keys[m].add(key)
+		} else {
+			dt.ignored.fields[field] = true
+		}
+	}
+	return dt
+}
+
+// SetMaxHold sends nodes whose ignored fields alone changed on their own once
+// they were held back for d. With zero they wait for an update with other
+// changes.
+func (dt *DeltaTracker) SetMaxHold(d time.Duration) {
+	dt.maxHold = d
 }
 
 // GenerateDelta compares current graph with previous state and generates a delta
@@ -46,43 +159,50 @@ func (dt *DeltaTracker) GenerateDelta(currentGraph *kutype.Graph) (*DeltaUpdate,
 
 	// If this is the first time, return full update
 	if len(dt.previousNodes) == 0 && len(dt.previousLinks) == 0 {
-		log.Printf("First time delta generation, sending full update with %d nodes and %d links", 
+		log.Printf("First time delta generation, sending full update with %d nodes and %d links",
 			len(*currentGraph.Nodes), len(*currentGraph.Links))
-		
+
 		// Store current state
-		dt.updatePreviousState(currentGraph)
-		
-		return &DeltaUpdate{
-			Type:  "full",
-			Nodes: *currentGraph.Nodes,
-			Links: *currentGraph.Links,
-		}, nil
+		if err := dt.updatePreviousState(currentGraph); err != nil {
+			return nil, err
+		}
+		dt.revision++
+		return dt.Snapshot(), nil
 	}
 
 	// Create maps for current state
 	currentNodes := make(map[string]kutype.Node)
-	currentLinks := make(map[string]kutype.Link)
+	currentLinks := make(map[linkKey]kutype.Link)
 
 	for _, node := range *currentGraph.Nodes {
 		currentNodes[node.Id] = node
 	}
 
 	for _, link := range *currentGraph.Links {
-		linkKey := fmt.Sprintf("%s-%s", link.Source, link.Target)
-		currentLinks[linkKey] = link
+		currentLinks[keyOf(link)] = link
 	}
 
 	// Find changes
-	delta := &DeltaUpdate{Type: "delta"}
-	
+	delta := &DeltaUpdate{Type: "delta", Epoch: dt.epoch, BaseRevision: dt.revision}
+	nodeDigests := make(map[string]string, len(currentNodes))
+	linkDigests := make(map[linkKey]string, len(currentLinks))
+
 	// Find new or updated nodes
+	held := make(map[string]kutype.Node)
 	for id, currentNode := range currentNodes {
-		if previousNode, exists := dt.previousNodes[id]; !exists {
-			// New node
-			delta.Nodes = append(delta.Nodes, currentNode)
-		} else if !nodesEqual(previousNode, currentNode) {
-			// Updated node
-			delta.Nodes = append(delta.Nodes, currentNode)
+		previousNode, exists := dt.previousNodes[id]
+		if exists && dt.ignored.nodesEqual(previousNode, currentNode) {
+			if !(ignoredFields{}).nodesEqual(previousNode, currentNode) {
+				held[id] = currentNode
+			}
+			// Keep the node as clients have it until it is sent
+			currentNodes[id] = previousNode
+			nodeDigests[id] = dt.nodeDigests[id]
+			continue
+		}
+
+		if err := addNode(delta, nodeDigests, previousNode, currentNode, exists); err != nil {
+			return nil, err
 		}
 	}
 
@@ -93,126 +213,214 @@ func (dt *DeltaTracker) GenerateDelta(currentGraph *kutype.Graph) (*DeltaUpdate,
 		}
 	}
 
-	// Find new links
-	for linkKey, currentLink := range currentLinks {
-		if _, exists := dt.previousLinks[linkKey]; !exists {
+	// Find new or updated links
+	for key, currentLink := range currentLinks {
+		previousLink, exists := dt.previousLinks[key]
+		if exists && reflect.DeepEqual(previousLink, currentLink) {
+			linkDigests[key] = dt.linkDigests[key]
+			continue
+		}
+
+		if exists {
+			delta.UpdatedLinks = append(delta.UpdatedLinks, currentLink)
+		} else {
 			delta.Links = append(delta.Links, currentLink)
 		}
+		d, err := digest(currentLink)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash link %s -> %s: %s", currentLink.Source, currentLink.Target, err)
+		}
+		linkDigests[key] = d
 	}
 
 	// Find removed links
-	for linkKey, previousLink := range dt.previousLinks {
-		if _, exists := currentLinks[linkKey]; !exists {
+	for key, previousLink := range dt.previousLinks {
+		if _, exists := currentLinks[key]; !exists {
 			delta.RemovedLinks = append(delta.RemovedLinks, LinkRef{
-				Source: previousLink.Source,
-				Target: previousLink.Target,
+				Source:       previousLink.Source,
+				Target:       previousLink.Target,
+				Relationship: previousLink.Relationship,
 			})
 		}
 	}
 
-	// Update previous state
-	dt.updatePreviousState(currentGraph)
-
 	// Check if there are any changes
-	hasChanges := len(delta.Nodes) > 0 || len(delta.Links) > 0 || 
+	hasChanges := len(delta.Nodes) > 0 || len(delta.Links) > 0 || len(delta.UpdatedLinks) > 0 ||
 		len(delta.RemovedNodes) > 0 || len(delta.RemovedLinks) > 0
 
+	// Held back nodes go out with other changes, or on their own once the
+	// oldest of them waited for maxHold
+	if len(held) == 0 {
+		dt.heldSince = time.Time{}
+	} else if dt.heldSince.IsZero() {
+		dt.heldSince = time.Now()
+	}
+	if len(held) > 0 && (hasChanges || dt.maxHold > 0 && time.Since(dt.heldSince) >= dt.maxHold) {
+		for id, node := range held {
+			if err := addNode(delta, nodeDigests, dt.previousNodes[id], node, true); err != nil {
+				return nil, err
+			}
+			currentNodes[id] = node
+		}
+		dt.heldSince = time.Time{}
+		hasChanges = true
+	}
+
+	// Update previous state
+	dt.previousNodes = currentNodes
+	dt.previousLinks = currentLinks
+	dt.nodeDigests = nodeDigests
+	dt.linkDigests = linkDigests
+
 	if !hasChanges {
 		return nil, nil // No changes
 	}
+	dt.revision++
+	dt.checksum = checksum(nodeDigests, linkDigests)
+	delta.Revision = dt.revision
+	delta.Checksum = dt.checksum
 
-	log.Printf("Generated delta: +%d nodes, +%d links, -%d nodes, -%d links", 
-		len(delta.Nodes), len(delta.Links), len(delta.RemovedNodes), len(delta.RemovedLinks))
+	log.Printf("Generated delta: +%d nodes, +%d links, ~%d links, -%d nodes, -%d links",
+		len(delta.Nodes), len(delta.Links), len(delta.UpdatedLinks), len(delta.RemovedNodes), len(delta.RemovedLinks))
 
 	return delta, nil
 }
 
-// updatePreviousState updates the stored previous state
-func (dt *DeltaTracker) updatePreviousState(graph *kutype.Graph) {
+// addNode adds a new or updated node to delta and hashes it into digests
+func addNode(delta *DeltaUpdate, digests map[string]string, previous, current kutype.Node, exists bool) error {
+	delta.Nodes = append(delta.Nodes, current)
+	if exists {
+		// Updated node, clients in patch mode only receive what changed
+		patch, err := mergePatch(previous, current)
+		if err != nil {
+			return fmt.Errorf("failed to diff node %s: %s", current.Id, err)
+		}
+		delta.NodePatches = append(delta.NodePatches, NodePatch{Id: current.Id, Patch: patch})
+	}
+	d, err := digest(current)
+	if err != nil {
+		return fmt.Errorf("failed to hash node %s: %s", current.Id, err)
+	}
+	digests[current.Id] = d
+	return nil
+}
+
+// updatePreviousState replaces the stored previous state and its checksum
+func (dt *DeltaTracker) updatePreviousState(graph *kutype.Graph) error {
 	// Clear previous state
 	dt.previousNodes = make(map[string]kutype.Node)
-	dt.previousLinks = make(map[string]kutype.Link)
+	dt.previousLinks = make(map[linkKey]kutype.Link)
+	dt.nodeDigests = make(map[string]string)
+	dt.linkDigests = make(map[linkKey]string)
 
 	// Store current state as previous
 	for _, node := range *graph.Nodes {
+		d, err := digest(node)
+		if err != nil {
+			return fmt.Errorf("failed to hash node %s: %s", node.Id, err)
+		}
 		dt.previousNodes[node.Id] = node
+		dt.nodeDigests[node.Id] = d
 	}
 
 	for _, link := range *graph.Links {
-		linkKey := fmt.Sprintf("%s-%s", link.Source, link.Target)
-		dt.previousLinks[linkKey] = link
+		d, err := digest(link)
+		if err != nil {
+			return fmt.Errorf("failed to hash link %s -> %s: %s", link.Source, link.Target, err)
+		}
+		dt.previousLinks[keyOf(link)] = link
+		dt.linkDigests[keyOf(link)] = d
 	}
+	dt.checksum = checksum(dt.nodeDigests, dt.linkDigests)
+	return nil
 }
 
-// nodesEqual compares two nodes for equality
-func nodesEqual(a, b kutype.Node) bool {
+// nodesEqual compares two nodes for equality, skipping the ignored fields
+func (ig ignoredFields) nodesEqual(a, b kutype.Node) bool {
+	ignored := ig.fields
+
 	// Compare basic fields
-	if a.Id != b.Id || a.Name != b.Name || a.Type != b.Type || 
-		a.Namespace != b.Namespace || a.Status != b.Status || 
-		a.StatusMessage != b.StatusMessage || a.CreationTime != b.CreationTime || 
-		a.Age != b.Age {
+	if a.Id != b.Id || a.Name != b.Name || a.Type != b.Type || a.Namespace != b.Namespace {
+		return false
+	}
+	if !ignored["status"] && a.Status != b.Status {
+		return false
+	}
+	if !ignored["statusmessage"] && a.StatusMessage != b.StatusMessage {
+		return false
+	}
+	if !ignored["creationtime"] && a.CreationTime != b.CreationTime {
 		return false
 	}
 
 	// Compare labels
-	if !mapsEqual(a.Labels, b.Labels) {
+	if !ignored["labels"] && !mapsEqual(a.Labels, b.Labels, ig.keys["labels"]) {
 		return false
 	}
 
 	// Compare annotations
-	if !mapsEqual(a.Annotations, b.Annotations) {
+	if !ignored["annotations"] && !mapsEqual(a.Annotations, b.Annotations, ig.keys["annotations"]) {
 		return false
 	}
 
 	// Compare resource info with smart array comparison
-	if !resourceInfoEqual(a.ResourceInfo, b.ResourceInfo) {
+	if !ignored["resourceinfo"] && !resourceInfoEqual(a.ResourceInfo, b.ResourceInfo, ig.keys["resourceinfo"]) {
 		return false
 	}
 
 	return true
 }
 
-// mapsEqual compares two string maps
-func mapsEqual(a, b map[string]string) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	
+// mapsEqual compares two string maps, skipping the ignored keys
+func mapsEqual(a, b map[string]string, ignored *keySet) bool {
 	for k, v := range a {
-		if b[k] != v {
+		if ignored.has(k) {
+			continue
+		}
+		if other, exists := b[k]; !exists || other != v {
+			return false
+		}
+	}
+	for k := range b {
+		if _, exists := a[k]; !exists && !ignored.has(k) {
 			return false
 		}
 	}
-	
 	return true
 }
 
-// resourceInfoEqual compares resource info maps with smart array handling
-func resourceInfoEqual(a, b map[string]interface{}) bool {
-	if len(a) != len(b) {
-		return false
-	}
-	
+// resourceInfoEqual compares resource info maps with smart array handling,
+// skipping the ignored keys
+func resourceInfoEqual(a, b map[string]interface{}, ignored *keySet) bool {
 	// Fields where array order should be ignored
 	orderIgnoredArrayFields := map[string]bool{
-		"key_names":           true,  // ConfigMap/Secret keys
-		"conditions":          true,  // Node/Pod conditions
-		"external_ips":        true,  // Service external IPs
-		"image_pull_secrets":  true,  // Pod image pull secrets
-		"volumes":             true,  // Pod volumes (when represented as arrays)
-		"containers":          true,  // Pod containers (when represented as name arrays)
-		"ports":               true,  // Service ports (when represented as arrays)
-		"rules":               true,  // Ingress rules (when represented as arrays)
-		"hosts":               true,  // Ingress hosts
-		"secrets":             true,  // ServiceAccount secrets
+		"key_names":          true, // ConfigMap/Secret keys
+		"conditions":         true, // Node/Pod conditions
+		"external_ips":       true, // Service external IPs
+		"image_pull_secrets": true, // Pod image pull secrets
+		"volumes":            true, // Pod volumes (when represented as arrays)
+		"containers":         true, // Pod containers (when represented as name arrays)
+		"ports":              true, // Service ports (when represented as arrays)
+		"rules":              true, // Ingress rules (when represented as arrays)
+		"hosts":              true, // Ingress hosts
+		"secrets":            true, // ServiceAccount secrets
 	}
-	
+
+	for key := range b {
+		if _, exists := a[key]; !exists && !ignored.has(key) {
+			return false
+		}
+	}
+
 	for key, valueA := range a {
+		if ignored.has(key) {
+			continue
+		}
 		valueB, exists := b[key]
 		if !exists {
 			return false
 		}
-		
+
 		// Special handling for arrays where order doesn't matter
 		if orderIgnoredArrayFields[key] {
 			if !arraysEqualIgnoreOrder(valueA, valueB) {
@@ -225,7 +433,7 @@ func resourceInfoEqual(a, b map[string]interface{}) bool {
 			}
 		}
 	}
-	
+
 	return true
 }
 
@@ -299,10 +507,70 @@ func (du *DeltaUpdate) ToJSON() ([]byte, error) {
 	return json.Marshal(du)
 }
 
-// Reset clears the delta tracker state (useful for testing or reset scenarios)
+// Reset clears the delta tracker state (useful for testing or reset scenarios).
+// Revisions keep counting, the next update is a full one.
 func (dt *DeltaTracker) Reset() {
 	dt.previousNodes = make(map[string]kutype.Node)
-	dt.previousLinks = make(map[string]kutype.Link)
+	dt.previousLinks = make(map[linkKey]kutype.Link)
+	dt.nodeDigests = make(map[string]string)
+	dt.linkDigests = make(map[linkKey]string)
+	dt.checksum = ""
+	dt.snapshot = nil
+	dt.snapshotJSON = nil
+	dt.heldSince = time.Time{}
+}
+
+// Snapshot returns a full update with the graph at the current revision, nil
+// if no graph has been tracked yet. The update is built once per revision and
+// shared, it must not be modified.
+func (dt *DeltaTracker) Snapshot() *DeltaUpdate {
+	if dt.revision == 0 || (len(dt.previousNodes) == 0 && len(dt.previousLinks) == 0) {
+		return nil
+	}
+	if dt.snapshot != nil && dt.snapshot.Revision == dt.revision {
+		return dt.snapshot
+	}
+
+	snapshot := &DeltaUpdate{
+		Type:     "full",
+		Epoch:    dt.epoch,
+		Revision: dt.revision,
+		Checksum: dt.checksum,
+		Nodes:    make([]kutype.Node, 0, len(dt.previousNodes)),
+		Links:    make([]kutype.Link, 0, len(dt.previousLinks)),
+	}
+	for _, node := range dt.previousNodes {
+		snapshot.Nodes = append(snapshot.Nodes, node)
+	}
+	for _, link := range dt.previousLinks {
+		snapshot.Links = append(snapshot.Links, link)
+	}
+	dt.snapshot = snapshot
+	dt.snapshotJSON = nil
+	return snapshot
+}
+
+// SnapshotJSON returns the encoded Snapshot, nil if no graph has been tracked
+// yet. Like the snapshot it is encoded once per revision, clients connecting
+// in between share it.
+func (dt *DeltaTracker) SnapshotJSON() ([]byte, error) {
+	snapshot := dt.Snapshot()
+	if snapshot == nil {
+		return nil, nil
+	}
+	if dt.snapshotJSON == nil {
+		data, err := snapshot.ToJSON()
+		if err != nil {
+			return nil, err
+		}
+		dt.snapshotJSON = data
+	}
+	return dt.snapshotJSON, nil
+}
+
+// Epoch returns the epoch the tracker numbers its revisions in
+func (dt *DeltaTracker) Epoch() string {
+	return dt.epoch
 }
 
 // GetStats returns statistics about the current state
@@ -310,5 +578,6 @@ func (dt *DeltaTracker) GetStats() map[string]int {
 	return map[string]int{
 		"previous_nodes": len(dt.previousNodes),
 		"previous_links": len(dt.previousLinks),
+		"revision":       int(dt.revision),
 	}
 }
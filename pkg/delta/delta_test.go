@@ -0,0 +1,120 @@
+package delta
+
+import (
+	"testing"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// podGraph returns two pods, web-0 with cpuUsage and web-1 with status
+func podGraph(cpuUsage, status string) *kutype.Graph {
+	nodes := []kutype.Node{
+		{Id: "pod/default/web-0", Name: "web-0", Type: "pod", Namespace: "default", Status: "Running",
+			ResourceInfo: map[string]interface{}{"cpu_usage": cpuUsage}},
+		{Id: "pod/default/web-1", Name: "web-1", Type: "pod", Namespace: "default", Status: status},
+	}
+	links := []kutype.Link{}
+	return &kutype.Graph{Nodes: &nodes, Links: &links}
+}
+
+// nodeIn returns the node with id from update, nil if it isn't in it
+func nodeIn(update *DeltaUpdate, id string) *kutype.Node {
+	for i := range update.Nodes {
+		if update.Nodes[i].Id == id {
+			return &update.Nodes[i]
+		}
+	}
+	return nil
+}
+
+func TestGenerateDeltaSendsUsage(t *testing.T) {
+	dt := NewDeltaTracker()
+	if _, err := dt.GenerateDelta(podGraph("100m", "Running")); err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	update, err := dt.GenerateDelta(podGraph("200m", "Running"))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update == nil {
+		t.Fatalf("usage change produced no update")
+	}
+	if node := nodeIn(update, "pod/default/web-0"); node == nil || node.ResourceInfo["cpu_usage"] != "200m" {
+		t.Errorf("expected web-0 with the new usage, got %+v", update.Nodes)
+	}
+}
+
+func TestGenerateDeltaHoldsBackIgnoredFields(t *testing.T) {
+	dt := NewDeltaTracker("resourceinfo.cpu_usage*")
+	if _, err := dt.GenerateDelta(podGraph("100m", "Running")); err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+
+	update, err := dt.GenerateDelta(podGraph("200m", "Running"))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update != nil {
+		t.Fatalf("change to ignored fields alone produced an update %+v", update)
+	}
+	if node := nodeIn(dt.Snapshot(), "pod/default/web-0"); node.ResourceInfo["cpu_usage"] != "100m" {
+		t.Errorf("snapshot has usage %v, want the usage clients hold", node.ResourceInfo["cpu_usage"])
+	}
+
+	// The held back node goes out with the next change
+	graph := podGraph("300m", "Failed")
+	update, err = dt.GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update == nil || nodeIn(update, "pod/default/web-1") == nil {
+		t.Fatalf("expected an update with web-1, got %+v", update)
+	}
+	if node := nodeIn(update, "pod/default/web-0"); node == nil || node.ResourceInfo["cpu_usage"] != "300m" {
+		t.Errorf("expected web-0 with the latest usage in the update, got %+v", update.Nodes)
+	}
+	if len(update.NodePatches) != 2 {
+		t.Errorf("expected patches for both pods, got %+v", update.NodePatches)
+	}
+	fresh, err := NewDeltaTracker().GenerateDelta(graph)
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update.Checksum != fresh.Checksum {
+		t.Errorf("checksum %s doesn't match the graph clients end up with %s", update.Checksum, fresh.Checksum)
+	}
+
+	if update, err := dt.GenerateDelta(graph); err != nil || update != nil {
+		t.Errorf("unchanged graph = %+v, %v, want no update", update, err)
+	}
+}
+
+func TestGenerateDeltaFlushesHeldNodes(t *testing.T) {
+	dt := NewDeltaTracker("resourceinfo.cpu_usage*")
+	dt.SetMaxHold(50 * time.Millisecond)
+	if _, err := dt.GenerateDelta(podGraph("100m", "Running")); err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+
+	if update, err := dt.GenerateDelta(podGraph("200m", "Running")); err != nil || update != nil {
+		t.Fatalf("change to ignored fields = %+v, %v, want it held back", update, err)
+	}
+	time.Sleep(60 * time.Millisecond)
+
+	update, err := dt.GenerateDelta(podGraph("250m", "Running"))
+	if err != nil {
+		t.Fatalf("GenerateDelta failed: %s", err)
+	}
+	if update == nil {
+		t.Fatalf("held back node wasn't sent after the max hold")
+	}
+	if node := nodeIn(update, "pod/default/web-0"); node == nil || node.ResourceInfo["cpu_usage"] != "250m" || len(update.Nodes) != 1 {
+		t.Errorf("expected only web-0 with the latest usage, got %+v", update.Nodes)
+	}
+
+	// The hold starts over with the next change
+	if update, err := dt.GenerateDelta(podGraph("300m", "Running")); err != nil || update != nil {
+		t.Errorf("change right after a flush = %+v, %v, want it held back", update, err)
+	}
+}
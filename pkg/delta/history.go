@@ -0,0 +1,47 @@
+package delta
+
+// History keeps the most recent updates so clients that reconnect can catch
+// up on the updates they missed instead of loading the whole graph again
+type History struct {
+	size    int
+	updates []*DeltaUpdate
+}
+
+// NewHistory creates a history that keeps the last size updates
+func NewHistory(size int) *History {
+	return &History{size: size, updates: make([]*DeltaUpdate, 0, size)}
+}
+
+// Add records an update, dropping the oldest one when the history is full
+func (h *History) Add(update *DeltaUpdate) {
+	if h.size <= 0 {
+		return
+	}
+	if len(h.updates) == h.size {
+		copy(h.updates, h.updates[1:])
+		h.updates = h.updates[:h.size-1]
+	}
+	h.updates = append(h.updates, update)
+}
+
+// Since returns the updates that follow revision in epoch, in order. It
+// reports false if they are no longer all in the history, in which case the
+// client needs a full update.
+func (h *History) Since(epoch string, revision uint64) ([]*DeltaUpdate, bool) {
+	if len(h.updates) == 0 {
+		return nil, false
+	}
+	latest := h.updates[len(h.updates)-1]
+	if latest.Epoch != epoch || revision > latest.Revision {
+		return nil, false
+	}
+	if revision == latest.Revision {
+		return nil, true
+	}
+	for i, update := range h.updates {
+		if update.Type == "delta" && update.BaseRevision == revision {
+			return h.updates[i:], true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,103 @@
+package delta
+
+import (
+	"encoding/json"
+	"reflect"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// Update modes a client can negotiate for changed nodes
+const (
+	// ModeFull sends changed nodes in full
+	ModeFull = "full"
+	// ModeMergePatch sends changed nodes as RFC 7386 JSON Merge Patches
+	// against the node the client already has
+	ModeMergePatch = "merge-patch"
+)
+
+// NodePatch is a JSON Merge Patch for a node the client already has
+type NodePatch struct {
+	Id    string          `json:"id"`
+	Patch json.RawMessage `json:"patch"`
+}
+
+// ForMode returns the delta as sent to clients in mode. In ModeMergePatch
+// changed nodes are replaced by their patches, new nodes are still sent in
+// full. In ModeFull no patches are sent.
+func (du *DeltaUpdate) ForMode(mode string) *DeltaUpdate {
+	update := *du
+	if mode != ModeMergePatch || len(du.NodePatches) == 0 {
+		update.NodePatches = nil
+		return &update
+	}
+
+	patched := make(map[string]bool, len(du.NodePatches))
+	for _, patch := range du.NodePatches {
+		patched[patch.Id] = true
+	}
+	update.Nodes = make([]kutype.Node, 0, len(du.Nodes)-len(du.NodePatches))
+	for _, node := range du.Nodes {
+		if !patched[node.Id] {
+			update.Nodes = append(update.Nodes, node)
+		}
+	}
+	return &update
+}
+
+// mergePatch returns the JSON Merge Patch that turns previous into current
+func mergePatch(previous, current kutype.Node) (json.RawMessage, error) {
+	previousFields, err := toFields(previous)
+	if err != nil {
+		return nil, err
+	}
+	currentFields, err := toFields(current)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(diffFields(previousFields, currentFields))
+}
+
+// toFields returns the JSON representation of a node as a generic map
+func toFields(node kutype.Node) (map[string]interface{}, error) {
+	data, err := json.Marshal(node)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// diffFields returns the merge patch between two JSON objects. Nested objects
+// are diffed recursively, other values including arrays are replaced and
+// removed fields are set to null.
+func diffFields(previous, current map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for key, currentValue := range current {
+		previousValue, exists := previous[key]
+		if !exists {
+			patch[key] = currentValue
+			continue
+		}
+		previousObject, previousIsObject := previousValue.(map[string]interface{})
+		currentObject, currentIsObject := currentValue.(map[string]interface{})
+		if previousIsObject && currentIsObject {
+			if nested := diffFields(previousObject, currentObject); len(nested) > 0 {
+				patch[key] = nested
+			}
+			continue
+		}
+		if !reflect.DeepEqual(previousValue, currentValue) {
+			patch[key] = currentValue
+		}
+	}
+	for key := range previous {
+		if _, exists := current[key]; !exists {
+			patch[key] = nil
+		}
+	}
+	return patch
+}
@@ -0,0 +1,271 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Cache is a watch-backed copy of the cluster objects the renderer reads.
+// Once started, building a graph from it costs no API server calls.
+type Cache struct {
+	factory        informers.SharedInformerFactory
+	dynamicFactory dynamicinformer.DynamicSharedInformerFactory
+	discovery      discovery.DiscoveryInterface
+	collectors     []ResourceCollector
+	informers      []cache.SharedIndexInformer
+	// metrics is nil unless the cluster serves the metrics API
+	metrics *metricsSource
+	changes chan struct{}
+}
+
+// NewCache creates a cache for the collectors enabled in opts. The informers
+// are not running until Start is called.
+func NewCache(opts Options) (*Cache, error) {
+	config, err := getKubernetesConfig(opts.Kubeconfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubernetes config: %s", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset for kubeconfig: %s", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client for kubeconfig: %s", err)
+	}
+
+	collectors, err := enabledCollectors(opts)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{
+		factory:        informers.NewSharedInformerFactoryWithOptions(clientset, 0, informers.WithTransform(stripObject)),
+		dynamicFactory: dynamicinformer.NewDynamicSharedInformerFactory(dynamicClient, 0),
+		discovery:      clientset.Discovery(),
+		changes:        make(chan struct{}, 1),
+	}
+
+	handler := cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.notify() },
+		UpdateFunc: func(interface{}, interface{}) { c.notify() },
+		DeleteFunc: func(interface{}) { c.notify() },
+	}
+	for _, collector := range collectors {
+		informer, err := collector.Informer(c)
+		if err != nil {
+			return nil, fmt.Errorf("failed to set up %s collector: %s", collector.Name(), err)
+		}
+		if informer == nil {
+			log.Printf("Skipping %s collector, the cluster does not serve its resources", collector.Name())
+			continue
+		}
+		if _, err := informer.AddEventHandler(handler); err != nil {
+			return nil, fmt.Errorf("failed to watch %s for changes: %s", collector.Name(), err)
+		}
+		c.collectors = append(c.collectors, collector)
+		c.informers = append(c.informers, informer)
+	}
+
+	if opts.MetricsInterval > 0 {
+		// Usage is optional, the graph is still complete without metrics-server
+		served, err := c.ServesResource(podMetricsResource)
+		if err != nil {
+			log.Printf("Skipping metrics, failed to discover the metrics API: %s", err)
+		} else if !served {
+			log.Printf("Skipping metrics, the cluster does not serve %s", podMetricsResource.GroupVersion())
+		} else {
+			c.metrics = newMetricsSource(dynamicClient, opts.MetricsInterval)
+		}
+	}
+
+	return c, nil
+}
+
+// Factory returns the shared informer factory collectors register their
+// informers with
+func (c *Cache) Factory() informers.SharedInformerFactory {
+	return c.factory
+}
+
+// DynamicFactory returns the shared informer factory for resources without
+// typed clients, such as custom resources
+func (c *Cache) DynamicFactory() dynamicinformer.DynamicSharedInformerFactory {
+	return c.dynamicFactory
+}
+
+// ServesResource reports whether the API server serves the given resource,
+// for collectors of resources that are only installed in some clusters
+func (c *Cache) ServesResource(gvr schema.GroupVersionResource) (bool, error) {
+	resources, err := c.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	for _, resource := range resources.APIResources {
+		if resource.Name == gvr.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// Start runs the informers and the metrics poller until ctx is done and
+// blocks until their initial lists have been synced.
+func (c *Cache) Start(ctx context.Context) error {
+	c.factory.Start(ctx.Done())
+	c.dynamicFactory.Start(ctx.Done())
+	for i, informer := range c.informers {
+		if !cache.WaitForCacheSync(ctx.Done(), informer.HasSynced) {
+			return fmt.Errorf("failed to sync %s", c.collectors[i].Name())
+		}
+	}
+
+	if c.metrics != nil {
+		if _, err := c.metrics.refresh(ctx); err != nil {
+			log.Printf("Failed to fetch metrics: %s", err)
+		}
+		go c.metrics.run(ctx, c.notify)
+	}
+	return nil
+}
+
+// Changes returns a channel that receives a value after the cached cluster
+// state changed. Bursts of changes are collapsed into a single notification.
+func (c *Cache) Changes() <-chan struct{} {
+	return c.changes
+}
+
+// notify records a change without blocking the informer if one is already pending
+func (c *Cache) notify() {
+	select {
+	case c.changes <- struct{}{}:
+	default:
+	}
+}
+
+// Shutdown waits for all informer goroutines to exit. The context passed to
+// Start must be cancelled first.
+func (c *Cache) Shutdown() {
+	c.factory.Shutdown()
+	c.dynamicFactory.Shutdown()
+}
+
+// stripManagedFields drops metadata.managedFields before objects are stored,
+// they are never rendered and make up a large share of the cache's memory.
+func stripManagedFields(obj interface{}) (interface{}, error) {
+	if _, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return obj, nil
+	}
+	if accessor, err := meta.Accessor(obj); err == nil {
+		accessor.SetManagedFields(nil)
+	}
+	return obj, nil
+}
+
+// dataSizeAnnotation holds the total size of the values stripObject removed
+// from a config map or secret
+const dataSizeAnnotation = "kube-universe.io/data-size-bytes"
+
+// stripObject is the transform of the typed informers. Besides the managed
+// fields it empties config map and secret values, only their key names and
+// total size are rendered. Objects can pass through more than once, the size
+// annotation marks the ones that were stripped already.
+func stripObject(obj interface{}) (interface{}, error) {
+	obj, err := stripManagedFields(obj)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *corev1.ConfigMap:
+		if _, stripped := o.Annotations[dataSizeAnnotation]; stripped {
+			break
+		}
+		size := 0
+		for key, value := range o.Data {
+			size += len(value)
+			o.Data[key] = ""
+		}
+		for key, value := range o.BinaryData {
+			size += len(value)
+			o.BinaryData[key] = nil
+		}
+		o.Annotations = withDataSize(o.Annotations, size)
+	case *corev1.Secret:
+		if _, stripped := o.Annotations[dataSizeAnnotation]; stripped {
+			break
+		}
+		size := 0
+		for key, value := range o.Data {
+			size += len(value)
+			o.Data[key] = nil
+		}
+		for key, value := range o.StringData {
+			size += len(value)
+			o.StringData[key] = ""
+		}
+		o.Annotations = withDataSize(o.Annotations, size)
+	}
+	return obj, nil
+}
+
+func withDataSize(annotations map[string]string, size int) map[string]string {
+	if annotations == nil {
+		annotations = make(map[string]string, 1)
+	}
+	annotations[dataSizeAnnotation] = strconv.Itoa(size)
+	return annotations
+}
+
+// dataSize returns the total value size stripObject recorded for an object
+func dataSize(annotations map[string]string) int {
+	size, _ := strconv.Atoi(annotations[dataSizeAnnotation])
+	return size
+}
+
+// withoutDataSize returns annotations without the one stripObject added. The
+// cached map is shared and left untouched.
+func withoutDataSize(annotations map[string]string) map[string]string {
+	if _, ok := annotations[dataSizeAnnotation]; !ok {
+		return annotations
+	}
+	filtered := make(map[string]string, len(annotations)-1)
+	for key, value := range annotations {
+		if key != dataSizeAnnotation {
+			filtered[key] = value
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,71 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestStripObjectRemovesSecretValues(t *testing.T) {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: "db", Namespace: "default"},
+		Data:       map[string][]byte{"password": []byte("hunter22"), "user": []byte("admin")},
+	}
+
+	// Objects can pass through the transform more than once
+	for i := 0; i < 2; i++ {
+		if _, err := stripObject(secret); err != nil {
+			t.Fatalf("stripObject failed: %s", err)
+		}
+	}
+	for key, value := range secret.Data {
+		if len(value) != 0 {
+			t.Errorf("value of %s is still cached: %q", key, value)
+		}
+	}
+
+	node := secretCollector{}.BuildNode(secret)
+	if size := node.ResourceInfo["total_size_bytes"]; size != 13 {
+		t.Errorf("total_size_bytes = %v, want 13", size)
+	}
+	if keys := node.ResourceInfo["key_names"].([]string); len(keys) != 2 || keys[0] != "password" || keys[1] != "user" {
+		t.Errorf("key_names = %v, want [password user]", keys)
+	}
+}
+
+func TestStripObjectKeepsConfigMapAnnotations(t *testing.T) {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", Annotations: map[string]string{"owner": "team-a"}},
+		Data:       map[string]string{"config.yaml": "debug: true"},
+		BinaryData: map[string][]byte{"logo.png": {0x89, 0x50}},
+	}
+	if _, err := stripObject(cm); err != nil {
+		t.Fatalf("stripObject failed: %s", err)
+	}
+	if cm.Data["config.yaml"] != "" || len(cm.BinaryData["logo.png"]) != 0 {
+		t.Errorf("values are still cached: %v %v", cm.Data, cm.BinaryData)
+	}
+
+	node := configMapCollector{}.BuildNode(cm)
+	if size := node.ResourceInfo["total_size_bytes"]; size != 13 {
+		t.Errorf("total_size_bytes = %v, want 13", size)
+	}
+	if len(node.Annotations) != 1 || node.Annotations["owner"] != "team-a" {
+		t.Errorf("node annotations = %v, want only the object's own", node.Annotations)
+	}
+}
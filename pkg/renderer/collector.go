@@ -0,0 +1,219 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"sync"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// ResourceCollector turns one kind of cluster object into graph nodes and links.
+//
+// Graphs are built in two passes: BuildNode is called for every listed object
+// of every collector first, then BuildLinks, so links can refer to nodes of
+// any kind regardless of registration order. Owner references are linked for
+// every collector by UID, BuildLinks only adds the remaining relationships.
+type ResourceCollector interface {
+	// Name identifies the collector in configuration, e.g. "pods"
+	Name() string
+	// Informer returns the informer that lists and watches the collector's
+	// objects. It is called once per cache, before the cache is started. A nil
+	// informer skips the collector, e.g. when the cluster lacks its resources.
+	Informer(c *Cache) (cache.SharedIndexInformer, error)
+	// BuildNode converts a listed object into a node, nil skips the object
+	BuildNode(obj interface{}) *kutype.Node
+	// BuildLinks adds the links of a listed object once all nodes exist
+	BuildLinks(obj interface{}, g *GraphBuilder)
+}
+
+// GraphFinalizer is implemented by collectors that need to look at the
+// complete graph. FinalizeGraph is called once after all links were built.
+type GraphFinalizer interface {
+	FinalizeGraph(g *GraphBuilder)
+}
+
+var (
+	registryMu sync.Mutex
+	registry   []ResourceCollector
+)
+
+// RegisterCollector adds a collector to the registry. Collectors registered
+// after a cache was created are only picked up by caches created later.
+func RegisterCollector(collector ResourceCollector) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	for _, registered := range registry {
+		if registered.Name() == collector.Name() {
+			panic(fmt.Sprintf("collector %q is already registered", collector.Name()))
+		}
+	}
+	registry = append(registry, collector)
+}
+
+// CollectorNames returns the names of all registered collectors in registration order
+func CollectorNames() []string {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	names := make([]string, 0, len(registry))
+	for _, collector := range registry {
+		names = append(names, collector.Name())
+	}
+	return names
+}
+
+// enabledCollectors returns the registered collectors and the custom
+// resource collectors configured in opts, filtered by the selection in opts
+func enabledCollectors(opts Options) ([]ResourceCollector, error) {
+	registryMu.Lock()
+	candidates := append([]ResourceCollector(nil), registry...)
+	registryMu.Unlock()
+
+	known := make(map[string]bool, len(candidates))
+	for _, collector := range candidates {
+		known[collector.Name()] = true
+	}
+	for _, resource := range opts.CustomResources {
+		collector, err := newCustomResourceCollector(resource)
+		if err != nil {
+			return nil, err
+		}
+		if known[collector.Name()] {
+			return nil, fmt.Errorf("collector %q is configured more than once", collector.Name())
+		}
+		known[collector.Name()] = true
+		candidates = append(candidates, collector)
+	}
+
+	enabled := make(map[string]bool, len(opts.Collectors))
+	for _, name := range opts.Collectors {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		enabled[name] = true
+	}
+	disabled := make(map[string]bool, len(opts.DisabledCollectors))
+	for _, name := range opts.DisabledCollectors {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown collector %q", name)
+		}
+		disabled[name] = true
+	}
+
+	collectors := make([]ResourceCollector, 0, len(candidates))
+	for _, collector := range candidates {
+		if len(enabled) > 0 && !enabled[collector.Name()] {
+			continue
+		}
+		if disabled[collector.Name()] {
+			continue
+		}
+		collectors = append(collectors, collector)
+	}
+	return collectors, nil
+}
+
+// GraphBuilder collects the nodes and links of a graph while it is rendered
+type GraphBuilder struct {
+	nodes map[string]*kutype.Node
+	links []kutype.Link
+	// uids maps object UIDs to node ids for resolving owner references
+	uids map[types.UID]string
+	// networkPolicies are linked once the graph is complete, see
+	// networkPolicyCollector.FinalizeGraph
+	networkPolicies []*networkingv1.NetworkPolicy
+	// referenceGrants are the ReferenceGrants by namespace, see
+	// referenceGrantCollector
+	referenceGrants map[string][]*unstructured.Unstructured
+	// crossNamespaceBackends are route backends in other namespaces, they are
+	// linked once all ReferenceGrants are recorded, see
+	// gatewayAPICollector.FinalizeGraph
+	crossNamespaceBackends []backendRef
+}
+
+func newGraphBuilder() *GraphBuilder {
+	return &GraphBuilder{
+		nodes: make(map[string]*kutype.Node),
+		links: make([]kutype.Link, 0),
+		uids:  make(map[types.UID]string),
+
+		referenceGrants: make(map[string][]*unstructured.Unstructured),
+	}
+}
+
+// AddNode adds a node, replacing any node with the same id
+func (g *GraphBuilder) AddNode(node *kutype.Node) {
+	g.nodes[node.Id] = node
+}
+
+// HasNode reports whether a node with the given id was added
+func (g *GraphBuilder) HasNode(id string) bool {
+	_, exists := g.nodes[id]
+	return exists
+}
+
+// Node returns the node with the given id, or nil
+func (g *GraphBuilder) Node(id string) *kutype.Node {
+	return g.nodes[id]
+}
+
+// NodesOfType returns all added nodes of the given type
+func (g *GraphBuilder) NodesOfType(nodeType string) []*kutype.Node {
+	nodes := make([]*kutype.Node, 0)
+	for _, node := range g.nodes {
+		if node.Type == nodeType {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+// AddLink adds a link between two nodes
+func (g *GraphBuilder) AddLink(source, target, relationship string) {
+	g.links = append(g.links, kutype.Link{Source: source, Target: target, Value: 0, Relationship: relationship})
+}
+
+// LinkIfExists adds a link if both nodes were added, for references to
+// objects that may be missing or whose collector is disabled
+func (g *GraphBuilder) LinkIfExists(source, target, relationship string) {
+	if g.HasNode(source) && g.HasNode(target) {
+		g.AddLink(source, target, relationship)
+	}
+}
+
+// LinkConsumerIfExists adds a depends_on link from a config map or secret to
+// a pod consuming it if both nodes were added
+func (g *GraphBuilder) LinkConsumerIfExists(source, target string, consumption, keys []string) {
+	if g.HasNode(source) && g.HasNode(target) {
+		g.links = append(g.links, kutype.Link{Source: source, Target: target, Value: 0, Relationship: relationshipDependsOn, Consumption: consumption, Keys: keys})
+	}
+}
+
+// Links returns the links added so far
+func (g *GraphBuilder) Links() []kutype.Link {
+	return g.links
+}
+
+// Graph returns the built graph
+func (g *GraphBuilder) Graph() kutype.Graph {
+	return kutype.Graph{Nodes: values(g.nodes), Links: &g.links}
+}
@@ -0,0 +1,618 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	RegisterCollector(namespaceCollector{})
+	RegisterCollector(nodeCollector{})
+	RegisterCollector(podCollector{})
+	RegisterCollector(serviceCollector{})
+	RegisterCollector(serviceAccountCollector{})
+	RegisterCollector(configMapCollector{})
+	RegisterCollector(secretCollector{})
+	RegisterCollector(persistentVolumeCollector{})
+	RegisterCollector(persistentVolumeClaimCollector{})
+}
+
+type namespaceCollector struct{}
+
+func (namespaceCollector) Name() string { return "namespaces" }
+
+func (namespaceCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().Namespaces().Informer(), nil
+}
+
+func (namespaceCollector) BuildNode(obj interface{}) *kutype.Node {
+	n, ok := obj.(*corev1.Namespace)
+	if !ok {
+		return nil
+	}
+	key := clusterKey(namespaceType, n.Name)
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["phase"] = string(n.Status.Phase)
+
+	return &kutype.Node{
+		Id:           key,
+		Name:         n.Name,
+		Type:         namespaceType,
+		Namespace:    n.Namespace,
+		CreationTime: n.CreationTimestamp.Format(time.RFC3339),
+		Labels:       n.Labels,
+		Annotations:  n.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (namespaceCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type nodeCollector struct{}
+
+func (nodeCollector) Name() string { return "nodes" }
+
+func (nodeCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().Nodes().Informer(), nil
+}
+
+func (nodeCollector) BuildNode(obj interface{}) *kutype.Node {
+	n, ok := obj.(*corev1.Node)
+	if !ok {
+		return nil
+	}
+	key := clusterKey(nodeType, n.Name)
+	resourceInfo := make(map[string]interface{})
+
+	// Node capacity and allocatable resources
+	if cpu := n.Status.Capacity["cpu"]; cpu.String() != "" {
+		resourceInfo["cpu_capacity"] = cpu.String()
+	}
+	if memory := n.Status.Capacity["memory"]; memory.String() != "" {
+		resourceInfo["memory_capacity"] = memory.String()
+	}
+	if storage := n.Status.Capacity["ephemeral-storage"]; storage.String() != "" {
+		resourceInfo["storage_capacity"] = storage.String()
+	}
+	cpuAllocatable := n.Status.Allocatable[corev1.ResourceCPU]
+	memoryAllocatable := n.Status.Allocatable[corev1.ResourceMemory]
+	resourceInfo["cpu_allocatable"] = cpuAllocatable.String()
+	resourceInfo["memory_allocatable"] = memoryAllocatable.String()
+	resourceInfo["cpu_allocatable_millicores"] = cpuAllocatable.MilliValue()
+	resourceInfo["memory_allocatable_bytes"] = memoryAllocatable.Value()
+
+	// Node conditions
+	conditions := make([]string, 0)
+	for _, condition := range n.Status.Conditions {
+		if condition.Status == "True" {
+			conditions = append(conditions, string(condition.Type))
+		}
+	}
+	resourceInfo["conditions"] = conditions
+	resourceInfo["kernel_version"] = n.Status.NodeInfo.KernelVersion
+	resourceInfo["os_image"] = n.Status.NodeInfo.OSImage
+	resourceInfo["container_runtime"] = n.Status.NodeInfo.ContainerRuntimeVersion
+
+	return &kutype.Node{
+		Id:           key,
+		Name:         n.Name,
+		Type:         nodeType,
+		Namespace:    n.Namespace,
+		Status:       string(n.Status.Phase),
+		CreationTime: n.CreationTimestamp.Format(time.RFC3339),
+		Labels:       n.Labels,
+		Annotations:  n.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (nodeCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+// FinalizeGraph sums up the requests and limits of the pods on each node once
+// all pods are in the graph. Finished pods no longer hold their resources.
+func (nodeCollector) FinalizeGraph(g *GraphBuilder) {
+	allocations := make(map[string]nodeAllocation)
+	for _, pod := range g.NodesOfType(podType) {
+		if pod.Status == string(corev1.PodSucceeded) || pod.Status == string(corev1.PodFailed) {
+			continue
+		}
+		nodeName, _ := pod.ResourceInfo["node_name"].(string)
+		if nodeName == "" {
+			continue
+		}
+		allocation := allocations[nodeName]
+		cpuRequests, _ := pod.ResourceInfo["cpu_requests_millicores"].(int64)
+		memoryRequests, _ := pod.ResourceInfo["memory_requests_bytes"].(int64)
+		cpuLimits, _ := pod.ResourceInfo["cpu_limits_millicores"].(int64)
+		memoryLimits, _ := pod.ResourceInfo["memory_limits_bytes"].(int64)
+		allocation.cpuRequests += cpuRequests
+		allocation.memoryRequests += memoryRequests
+		allocation.cpuLimits += cpuLimits
+		allocation.memoryLimits += memoryLimits
+		allocations[nodeName] = allocation
+	}
+
+	for _, node := range g.NodesOfType(nodeType) {
+		addNodeAllocation(node.ResourceInfo, allocations[node.Name])
+	}
+}
+
+type podCollector struct{}
+
+func (podCollector) Name() string { return "pods" }
+
+func (podCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().Pods().Informer(), nil
+}
+
+func (podCollector) BuildNode(obj interface{}) *kutype.Node {
+	p, ok := obj.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+	podKey := namespacedKey(podType, p.Namespace, p.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["containers"] = len(p.Spec.Containers)
+	resourceInfo["restart_count"] = 0
+	resourceInfo["node_name"] = p.Spec.NodeName
+	resourceInfo["service_account"] = p.Spec.ServiceAccountName
+	resourceInfo["host_network"] = p.Spec.HostNetwork
+	resourceInfo["dns_policy"] = string(p.Spec.DNSPolicy)
+
+	// Calculate total restart count
+	totalRestarts := int32(0)
+	for _, containerStatus := range p.Status.ContainerStatuses {
+		totalRestarts += containerStatus.RestartCount
+	}
+	resourceInfo["restart_count"] = totalRestarts
+
+	// Pod IP and Host IP
+	if p.Status.PodIP != "" {
+		resourceInfo["pod_ip"] = p.Status.PodIP
+	}
+	if p.Status.HostIP != "" {
+		resourceInfo["host_ip"] = p.Status.HostIP
+	}
+
+	// QoS Class
+	resourceInfo["qos_class"] = string(p.Status.QOSClass)
+
+	// Effective requests and limits, including init containers and sidecars
+	addPodResources(&p.Spec, resourceInfo)
+
+	return &kutype.Node{
+		Id:            podKey,
+		Name:          p.Name,
+		Type:          podType,
+		Namespace:     p.Namespace,
+		Status:        string(p.Status.Phase),
+		StatusMessage: p.Status.Message,
+		CreationTime:  p.CreationTimestamp.Format(time.RFC3339),
+		Labels:        p.Labels,
+		Annotations:   p.Annotations,
+		ResourceInfo:  resourceInfo,
+	}
+}
+
+func (podCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	p, ok := obj.(*corev1.Pod)
+	if !ok {
+		return
+	}
+	podKey := namespacedKey(podType, p.Namespace, p.Name)
+
+	if p.Spec.NodeName != "" {
+		g.LinkIfExists(podKey, clusterKey(nodeType, p.Spec.NodeName), relationshipRuns)
+	}
+
+	// Link pods to service accounts
+	if p.Spec.ServiceAccountName != "" {
+		saKey := namespacedKey(serviceAccountType, p.Namespace, p.Spec.ServiceAccountName)
+		g.LinkIfExists(saKey, podKey, relationshipDependsOn)
+	}
+
+	// Link pods to the config maps and secrets they consume
+	linkConfigReferences(g, podKey, p.Namespace, podConfigReferences(&p.Spec))
+
+	// Link pods to persistent volume claims
+	for _, volume := range p.Spec.Volumes {
+		if volume.PersistentVolumeClaim != nil {
+			pvcKey := namespacedKey(persistentVolumeClaimType, p.Namespace, volume.PersistentVolumeClaim.ClaimName)
+			g.LinkIfExists(pvcKey, podKey, relationshipDependsOn)
+		}
+	}
+}
+
+type serviceCollector struct{}
+
+func (serviceCollector) Name() string { return "services" }
+
+func (serviceCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().Services().Informer(), nil
+}
+
+func (serviceCollector) BuildNode(obj interface{}) *kutype.Node {
+	s, ok := obj.(*corev1.Service)
+	if !ok {
+		return nil
+	}
+	serviceKey := namespacedKey(serviceType, s.Namespace, s.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["service_type"] = string(s.Spec.Type)
+	resourceInfo["cluster_ip"] = s.Spec.ClusterIP
+	resourceInfo["ports"] = len(s.Spec.Ports)
+	resourceInfo["session_affinity"] = string(s.Spec.SessionAffinity)
+
+	// External IPs
+	if len(s.Spec.ExternalIPs) > 0 {
+		resourceInfo["external_ips"] = s.Spec.ExternalIPs
+	}
+
+	// Load balancer info
+	if s.Spec.Type == "LoadBalancer" {
+		if len(s.Status.LoadBalancer.Ingress) > 0 {
+			ingress := s.Status.LoadBalancer.Ingress[0]
+			if ingress.IP != "" {
+				resourceInfo["load_balancer_ip"] = ingress.IP
+			}
+			if ingress.Hostname != "" {
+				resourceInfo["load_balancer_hostname"] = ingress.Hostname
+			}
+		}
+	}
+
+	// Port details
+	portDetails := make([]map[string]interface{}, 0)
+	for _, port := range s.Spec.Ports {
+		portInfo := map[string]interface{}{
+			"name":        port.Name,
+			"port":        port.Port,
+			"target_port": port.TargetPort.String(),
+			"protocol":    string(port.Protocol),
+		}
+		if port.NodePort != 0 {
+			portInfo["node_port"] = port.NodePort
+		}
+		portDetails = append(portDetails, portInfo)
+	}
+	resourceInfo["port_details"] = portDetails
+
+	return &kutype.Node{
+		Id:           serviceKey,
+		Name:         s.Name,
+		Type:         serviceType,
+		Namespace:    s.Namespace,
+		Status:       string(s.Spec.Type),
+		CreationTime: s.CreationTimestamp.Format(time.RFC3339),
+		Labels:       s.Labels,
+		Annotations:  s.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (serviceCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type serviceAccountCollector struct{}
+
+func (serviceAccountCollector) Name() string { return "serviceaccounts" }
+
+func (serviceAccountCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().ServiceAccounts().Informer(), nil
+}
+
+func (serviceAccountCollector) BuildNode(obj interface{}) *kutype.Node {
+	sa, ok := obj.(*corev1.ServiceAccount)
+	if !ok {
+		return nil
+	}
+	saKey := namespacedKey(serviceAccountType, sa.Namespace, sa.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["secrets"] = len(sa.Secrets)
+	resourceInfo["image_pull_secrets"] = len(sa.ImagePullSecrets)
+	resourceInfo["automount_service_account_token"] = true
+	if sa.AutomountServiceAccountToken != nil {
+		resourceInfo["automount_service_account_token"] = *sa.AutomountServiceAccountToken
+	}
+
+	return &kutype.Node{
+		Id:           saKey,
+		Name:         sa.Name,
+		Type:         serviceAccountType,
+		Namespace:    sa.Namespace,
+		CreationTime: sa.CreationTimestamp.Format(time.RFC3339),
+		Labels:       sa.Labels,
+		Annotations:  sa.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (serviceAccountCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type configMapCollector struct{}
+
+func (configMapCollector) Name() string { return "configmaps" }
+
+func (configMapCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().ConfigMaps().Informer(), nil
+}
+
+func (configMapCollector) BuildNode(obj interface{}) *kutype.Node {
+	cm, ok := obj.(*corev1.ConfigMap)
+	if !ok {
+		return nil
+	}
+	cmKey := namespacedKey(configMapType, cm.Namespace, cm.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["data_keys"] = len(cm.Data)
+	resourceInfo["binary_data_keys"] = len(cm.BinaryData)
+	resourceInfo["total_keys"] = len(cm.Data) + len(cm.BinaryData)
+
+	// Values are stripped before the config map is cached, only their size is kept
+	resourceInfo["total_size_bytes"] = dataSize(cm.Annotations)
+
+	// List all key names, pods consume them by name
+	keyNames := make([]string, 0, len(cm.Data)+len(cm.BinaryData))
+	for key := range cm.Data {
+		keyNames = append(keyNames, key)
+	}
+	binaryKeyNames := make([]string, 0, len(cm.BinaryData))
+	for key := range cm.BinaryData {
+		binaryKeyNames = append(binaryKeyNames, key)
+	}
+	keyNames = append(keyNames, binaryKeyNames...)
+	sort.Strings(keyNames)
+	sort.Strings(binaryKeyNames)
+	resourceInfo["key_names"] = keyNames
+	resourceInfo["binary_key_names"] = binaryKeyNames
+
+	return &kutype.Node{
+		Id:           cmKey,
+		Name:         cm.Name,
+		Type:         configMapType,
+		Namespace:    cm.Namespace,
+		CreationTime: cm.CreationTimestamp.Format(time.RFC3339),
+		Labels:       cm.Labels,
+		Annotations:  withoutDataSize(cm.Annotations),
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (configMapCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+// FinalizeGraph lists the keys of each config map that no pod consumes
+func (configMapCollector) FinalizeGraph(g *GraphBuilder) {
+	markUnusedKeys(g, configMapType)
+}
+
+type secretCollector struct{}
+
+func (secretCollector) Name() string { return "secrets" }
+
+func (secretCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().Secrets().Informer(), nil
+}
+
+func (secretCollector) BuildNode(obj interface{}) *kutype.Node {
+	secret, ok := obj.(*corev1.Secret)
+	if !ok {
+		return nil
+	}
+	secretKey := namespacedKey(secretType, secret.Namespace, secret.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["secret_type"] = string(secret.Type)
+	resourceInfo["data_keys"] = len(secret.Data)
+	resourceInfo["string_data_keys"] = len(secret.StringData)
+	resourceInfo["total_keys"] = len(secret.Data) + len(secret.StringData)
+
+	// Values are stripped before the secret is cached, only their size is kept
+	resourceInfo["total_size_bytes"] = dataSize(secret.Annotations)
+
+	// List all key names, pods consume them by name (don't show values for security)
+	keyNames := make([]string, 0, len(secret.Data)+len(secret.StringData))
+	for key := range secret.Data {
+		keyNames = append(keyNames, key)
+	}
+	for key := range secret.StringData {
+		if _, exists := secret.Data[key]; !exists {
+			keyNames = append(keyNames, key)
+		}
+	}
+	sort.Strings(keyNames)
+	resourceInfo["key_names"] = keyNames
+
+	return &kutype.Node{
+		Id:           secretKey,
+		Name:         secret.Name,
+		Type:         secretType,
+		Namespace:    secret.Namespace,
+		Status:       string(secret.Type),
+		CreationTime: secret.CreationTimestamp.Format(time.RFC3339),
+		Labels:       map[string]string{},
+		Annotations:  map[string]string{},
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (secretCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+// FinalizeGraph lists the keys of each secret that no pod consumes
+func (secretCollector) FinalizeGraph(g *GraphBuilder) {
+	markUnusedKeys(g, secretType)
+}
+
+type persistentVolumeCollector struct{}
+
+func (persistentVolumeCollector) Name() string { return "persistentvolumes" }
+
+func (persistentVolumeCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().PersistentVolumes().Informer(), nil
+}
+
+func (persistentVolumeCollector) BuildNode(obj interface{}) *kutype.Node {
+	pv, ok := obj.(*corev1.PersistentVolume)
+	if !ok {
+		return nil
+	}
+	pvKey := clusterKey(persistentVolumeType, pv.Name)
+
+	resourceInfo := make(map[string]interface{})
+
+	// Capacity
+	if capacity := pv.Spec.Capacity["storage"]; capacity.String() != "" {
+		resourceInfo["capacity"] = capacity.String()
+	}
+
+	// Access modes
+	accessModes := make([]string, 0)
+	for _, mode := range pv.Spec.AccessModes {
+		accessModes = append(accessModes, string(mode))
+	}
+	resourceInfo["access_modes"] = accessModes
+
+	// Reclaim policy
+	if pv.Spec.PersistentVolumeReclaimPolicy != "" {
+		resourceInfo["reclaim_policy"] = string(pv.Spec.PersistentVolumeReclaimPolicy)
+	}
+
+	// Storage class
+	resourceInfo["storage_class"] = pv.Spec.StorageClassName
+
+	// Volume mode
+	if pv.Spec.VolumeMode != nil {
+		resourceInfo["volume_mode"] = string(*pv.Spec.VolumeMode)
+	}
+
+	// Claim reference
+	if pv.Spec.ClaimRef != nil {
+		resourceInfo["claim_ref"] = fmt.Sprintf("%s/%s", pv.Spec.ClaimRef.Namespace, pv.Spec.ClaimRef.Name)
+	}
+
+	// Volume source type
+	if pv.Spec.HostPath != nil {
+		resourceInfo["volume_source"] = "HostPath"
+	} else if pv.Spec.NFS != nil {
+		resourceInfo["volume_source"] = "NFS"
+	} else if pv.Spec.AWSElasticBlockStore != nil {
+		resourceInfo["volume_source"] = "AWS EBS"
+	} else if pv.Spec.GCEPersistentDisk != nil {
+		resourceInfo["volume_source"] = "GCE PD"
+	} else if pv.Spec.CSI != nil {
+		resourceInfo["volume_source"] = fmt.Sprintf("CSI (%s)", pv.Spec.CSI.Driver)
+	} else {
+		resourceInfo["volume_source"] = "Other"
+	}
+
+	return &kutype.Node{
+		Id:           pvKey,
+		Name:         pv.Name,
+		Type:         persistentVolumeType,
+		Namespace:    "", // PVs are cluster-scoped
+		Status:       string(pv.Status.Phase),
+		CreationTime: pv.CreationTimestamp.Format(time.RFC3339),
+		Labels:       pv.Labels,
+		Annotations:  pv.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (persistentVolumeCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type persistentVolumeClaimCollector struct{}
+
+func (persistentVolumeClaimCollector) Name() string { return "persistentvolumeclaims" }
+
+func (persistentVolumeClaimCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Core().V1().PersistentVolumeClaims().Informer(), nil
+}
+
+func (persistentVolumeClaimCollector) BuildNode(obj interface{}) *kutype.Node {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return nil
+	}
+	pvcKey := namespacedKey(persistentVolumeClaimType, pvc.Namespace, pvc.Name)
+
+	resourceInfo := make(map[string]interface{})
+
+	// Requested storage
+	if requests := pvc.Spec.Resources.Requests["storage"]; requests.String() != "" {
+		resourceInfo["requested_storage"] = requests.String()
+	}
+
+	// Access modes
+	accessModes := make([]string, 0)
+	for _, mode := range pvc.Spec.AccessModes {
+		accessModes = append(accessModes, string(mode))
+	}
+	resourceInfo["access_modes"] = accessModes
+
+	// Storage class
+	if pvc.Spec.StorageClassName != nil {
+		resourceInfo["storage_class"] = *pvc.Spec.StorageClassName
+	}
+
+	// Volume mode
+	if pvc.Spec.VolumeMode != nil {
+		resourceInfo["volume_mode"] = string(*pvc.Spec.VolumeMode)
+	}
+
+	// Volume name (bound PV)
+	resourceInfo["volume_name"] = pvc.Spec.VolumeName
+
+	// Phase
+	resourceInfo["phase"] = string(pvc.Status.Phase)
+
+	// Actual capacity (if bound)
+	if capacity := pvc.Status.Capacity["storage"]; capacity.String() != "" {
+		resourceInfo["actual_capacity"] = capacity.String()
+	}
+
+	return &kutype.Node{
+		Id:           pvcKey,
+		Name:         pvc.Name,
+		Type:         persistentVolumeClaimType,
+		Namespace:    pvc.Namespace,
+		Status:       string(pvc.Status.Phase),
+		CreationTime: pvc.CreationTimestamp.Format(time.RFC3339),
+		Labels:       pvc.Labels,
+		Annotations:  pvc.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (persistentVolumeClaimCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	pvc, ok := obj.(*corev1.PersistentVolumeClaim)
+	if !ok {
+		return
+	}
+
+	// Link PVC to PV if bound
+	if pvc.Spec.VolumeName != "" {
+		pvcKey := namespacedKey(persistentVolumeClaimType, pvc.Namespace, pvc.Name)
+		g.LinkIfExists(pvcKey, clusterKey(persistentVolumeType, pvc.Spec.VolumeName), relationshipClaims)
+	}
+}
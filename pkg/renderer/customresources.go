@@ -0,0 +1,170 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// CustomResource configures a collector for a resource that is listed through
+// the dynamic client, e.g. a custom resource installed by an operator
+type CustomResource struct {
+	// Group, Version and Resource name the resource to list, e.g.
+	// argoproj.io, v1alpha1 and rollouts
+	Group    string
+	Version  string
+	Resource string
+	// Status is an optional JSONPath expression for the node status, e.g. .status.phase
+	Status string
+	// ResourceInfo maps resource info keys to JSONPath expressions
+	ResourceInfo map[string]string
+}
+
+// customResourceCollector renders the objects of a configured custom
+// resource. Node types come from the object kind and API group, owner links
+// are resolved for all collectors by the graph builder.
+type customResourceCollector struct {
+	gvr schema.GroupVersionResource
+
+	// mu guards the JSONPath expressions, they keep state while executing
+	mu           sync.Mutex
+	status       *jsonpath.JSONPath
+	resourceInfo map[string]*jsonpath.JSONPath
+}
+
+func newCustomResourceCollector(resource CustomResource) (*customResourceCollector, error) {
+	if resource.Version == "" || resource.Resource == "" {
+		return nil, fmt.Errorf("custom resource %q needs a version and a resource", resource.Resource)
+	}
+
+	collector := &customResourceCollector{
+		gvr:          schema.GroupVersionResource{Group: resource.Group, Version: resource.Version, Resource: resource.Resource},
+		resourceInfo: make(map[string]*jsonpath.JSONPath, len(resource.ResourceInfo)),
+	}
+	if resource.Status != "" {
+		status, err := parseJSONPath("status", resource.Status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status expression for %s: %s", collector.Name(), err)
+		}
+		collector.status = status
+	}
+	for key, expression := range resource.ResourceInfo {
+		info, err := parseJSONPath(key, expression)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s expression for %s: %s", key, collector.Name(), err)
+		}
+		collector.resourceInfo[key] = info
+	}
+	return collector, nil
+}
+
+// parseJSONPath parses a JSONPath expression, the surrounding braces and the
+// leading dot may be left out as in kubectl's custom columns
+func parseJSONPath(name, expression string) (*jsonpath.JSONPath, error) {
+	if !strings.HasPrefix(expression, "{") {
+		if !strings.HasPrefix(expression, ".") {
+			expression = "." + expression
+		}
+		expression = "{" + expression + "}"
+	}
+	path := jsonpath.New(name).AllowMissingKeys(true)
+	if err := path.Parse(expression); err != nil {
+		return nil, err
+	}
+	return path, nil
+}
+
+func (cr *customResourceCollector) Name() string { return cr.gvr.GroupResource().String() }
+
+func (cr *customResourceCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	// Waiting for an unserved resource to sync would block forever, skip it
+	// like the optional built-in collectors
+	served, err := c.ServesResource(cr.gvr)
+	if err != nil {
+		return nil, err
+	}
+	if !served {
+		return nil, nil
+	}
+	informer := c.DynamicFactory().ForResource(cr.gvr).Informer()
+	if err := informer.SetTransform(stripManagedFields); err != nil {
+		return nil, err
+	}
+	return informer, nil
+}
+
+func (cr *customResourceCollector) BuildNode(obj interface{}) *kutype.Node {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	nodeType := customResourceType(u.GroupVersionKind().GroupKind())
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["api_version"] = u.GetAPIVersion()
+
+	cr.mu.Lock()
+	status := cr.evaluate(cr.status, u)
+	for key, path := range cr.resourceInfo {
+		resourceInfo[key] = cr.evaluate(path, u)
+	}
+	cr.mu.Unlock()
+
+	return &kutype.Node{
+		Id:           NodeID(nodeType, u.GetNamespace(), u.GetName()),
+		Name:         u.GetName(),
+		Type:         nodeType,
+		Namespace:    u.GetNamespace(),
+		Status:       status,
+		CreationTime: u.GetCreationTimestamp().Format(time.RFC3339),
+		Labels:       u.GetLabels(),
+		Annotations:  u.GetAnnotations(),
+		ResourceInfo: resourceInfo,
+	}
+}
+
+// customResourceType returns the node type of a custom resource, its lower
+// case kind qualified by its API group, e.g. rollout.argoproj.io. Kinds alone
+// collide, e.g. a Knative Service with the core Service.
+func customResourceType(gk schema.GroupKind) string {
+	if gk.Group == "" {
+		return strings.ToLower(gk.Kind)
+	}
+	return strings.ToLower(gk.Kind) + "." + gk.Group
+}
+
+// evaluate returns the text path produces for u, empty if path is nil or fails
+func (cr *customResourceCollector) evaluate(path *jsonpath.JSONPath, u *unstructured.Unstructured) string {
+	if path == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	if err := path.Execute(&buf, u.UnstructuredContent()); err != nil {
+		return ""
+	}
+	return buf.String()
+}
+
+func (cr *customResourceCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
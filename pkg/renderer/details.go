@@ -0,0 +1,68 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// detailFields are ResourceInfo entries that are only shown in a resource's
+// details, e.g. per-container resources or the keys of a config map. Slim
+// nodes leave them out.
+var detailFields = []string{
+	"binary_data_keys",
+	"binary_key_names",
+	"conditions",
+	"container_resources",
+	"data_keys",
+	"ip_blocks",
+	"listener_details",
+	"port_details",
+	"rule_summary",
+	"string_data_keys",
+}
+
+// SlimNode returns node without its details: labels, annotations and the
+// detail fields of its ResourceInfo. Annotations like
+// kubectl.kubernetes.io/last-applied-configuration often make up most of a
+// node's size.
+func SlimNode(node kutype.Node) kutype.Node {
+	node.Labels = nil
+	node.Annotations = nil
+	if len(node.ResourceInfo) == 0 {
+		return node
+	}
+
+	resourceInfo := make(map[string]interface{}, len(node.ResourceInfo))
+	for key, value := range node.ResourceInfo {
+		resourceInfo[key] = value
+	}
+	for _, key := range detailFields {
+		delete(resourceInfo, key)
+	}
+	node.ResourceInfo = resourceInfo
+	return node
+}
+
+// SlimGraph returns a copy of graph with slim nodes, see SlimNode
+func SlimGraph(graph *kutype.Graph) *kutype.Graph {
+	nodes := make([]kutype.Node, 0, len(*graph.Nodes))
+	for _, node := range *graph.Nodes {
+		nodes = append(nodes, SlimNode(node))
+	}
+	links := make([]kutype.Link, len(*graph.Links))
+	copy(links, *graph.Links)
+	return &kutype.Graph{Nodes: &nodes, Links: &links}
+}
@@ -0,0 +1,359 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// gatewayGroup is the API group of the Gateway API. Its resources are CRDs,
+// so they are read through the dynamic client and skipped when not installed.
+const gatewayGroup = "gateway.networking.k8s.io"
+
+func init() {
+	RegisterCollector(gatewayAPICollector{resource: "gatewayclasses", nodeType: gatewayClassType, versions: []string{"v1", "v1beta1"}})
+	RegisterCollector(gatewayAPICollector{resource: "gateways", nodeType: gatewayType, versions: []string{"v1", "v1beta1"}})
+	RegisterCollector(gatewayAPICollector{resource: "httproutes", nodeType: httpRouteType, versions: []string{"v1", "v1beta1"}})
+	RegisterCollector(gatewayAPICollector{resource: "grpcroutes", nodeType: grpcRouteType, versions: []string{"v1", "v1alpha2"}})
+	RegisterCollector(referenceGrantCollector{gatewayAPICollector{resource: "referencegrants", versions: []string{"v1", "v1beta1", "v1alpha2"}}})
+}
+
+// gatewayAPICollector renders one Gateway API resource. HTTPRoutes and
+// GRPCRoutes share their parent, hostname and backend fields.
+type gatewayAPICollector struct {
+	resource string
+	nodeType string
+	// versions lists the served versions to try, preferred first
+	versions []string
+}
+
+func (gc gatewayAPICollector) Name() string { return gc.resource }
+
+func (gc gatewayAPICollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	for _, version := range gc.versions {
+		gvr := schema.GroupVersionResource{Group: gatewayGroup, Version: version, Resource: gc.resource}
+		served, err := c.ServesResource(gvr)
+		if err != nil {
+			return nil, err
+		}
+		if !served {
+			continue
+		}
+		informer := c.DynamicFactory().ForResource(gvr).Informer()
+		if err := informer.SetTransform(stripManagedFields); err != nil {
+			return nil, err
+		}
+		return informer, nil
+	}
+	return nil, nil
+}
+
+func (gc gatewayAPICollector) BuildNode(obj interface{}) *kutype.Node {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+
+	resourceInfo := make(map[string]interface{})
+	var conditions []string
+	var status string
+	switch gc.nodeType {
+	case gatewayClassType:
+		controllerName, _, _ := unstructured.NestedString(u.Object, "spec", "controllerName")
+		resourceInfo["controller_name"] = controllerName
+		if description, found, _ := unstructured.NestedString(u.Object, "spec", "description"); found {
+			resourceInfo["description"] = description
+		}
+		conditions = trueConditions(u.Object, "status", "conditions")
+		status = conditionStatus(conditions, "Accepted")
+
+	case gatewayType:
+		gatewayClassName, _, _ := unstructured.NestedString(u.Object, "spec", "gatewayClassName")
+		resourceInfo["gateway_class"] = gatewayClassName
+
+		listeners, _, _ := unstructured.NestedSlice(u.Object, "spec", "listeners")
+		listenerDetails := make([]string, 0, len(listeners))
+		for _, l := range listeners {
+			listener, ok := l.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			name, _, _ := unstructured.NestedString(listener, "name")
+			protocol, _, _ := unstructured.NestedString(listener, "protocol")
+			port, _, _ := unstructured.NestedInt64(listener, "port")
+			detail := fmt.Sprintf("%s %s/%d", name, protocol, port)
+			if hostname, found, _ := unstructured.NestedString(listener, "hostname"); found {
+				detail += " " + hostname
+			}
+			listenerDetails = append(listenerDetails, detail)
+		}
+		resourceInfo["listeners"] = len(listeners)
+		resourceInfo["listener_details"] = listenerDetails
+
+		addresses, _, _ := unstructured.NestedSlice(u.Object, "status", "addresses")
+		addressValues := make([]string, 0, len(addresses))
+		for _, a := range addresses {
+			if address, ok := a.(map[string]interface{}); ok {
+				if value, found, _ := unstructured.NestedString(address, "value"); found {
+					addressValues = append(addressValues, value)
+				}
+			}
+		}
+		if len(addressValues) > 0 {
+			resourceInfo["addresses"] = addressValues
+		}
+		conditions = trueConditions(u.Object, "status", "conditions")
+		status = conditionStatus(conditions, "Programmed")
+
+	case httpRouteType, grpcRouteType:
+		hostnames, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "hostnames")
+		parentRefs, _, _ := unstructured.NestedSlice(u.Object, "spec", "parentRefs")
+		rules, _, _ := unstructured.NestedSlice(u.Object, "spec", "rules")
+		resourceInfo["hostnames"] = hostnames
+		resourceInfo["parent_refs"] = len(parentRefs)
+		resourceInfo["rules"] = len(rules)
+		resourceInfo["backends"] = len(routeBackendRefs(u))
+
+		// Routes report their conditions per parent gateway
+		parents, _, _ := unstructured.NestedSlice(u.Object, "status", "parents")
+		for _, p := range parents {
+			if parent, ok := p.(map[string]interface{}); ok {
+				conditions = append(conditions, trueConditions(parent, "conditions")...)
+			}
+		}
+		status = conditionStatus(conditions, "Accepted")
+	}
+	if conditions == nil {
+		conditions = make([]string, 0)
+	}
+	resourceInfo["conditions"] = conditions
+
+	return &kutype.Node{
+		Id:           NodeID(gc.nodeType, u.GetNamespace(), u.GetName()),
+		Name:         u.GetName(),
+		Type:         gc.nodeType,
+		Namespace:    u.GetNamespace(),
+		Status:       status,
+		CreationTime: u.GetCreationTimestamp().Format(time.RFC3339),
+		Labels:       u.GetLabels(),
+		Annotations:  u.GetAnnotations(),
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (gc gatewayAPICollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	u, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return
+	}
+	key := NodeID(gc.nodeType, u.GetNamespace(), u.GetName())
+
+	switch gc.nodeType {
+	case gatewayType:
+		// Link gateways to their gateway class
+		if gatewayClassName, found, _ := unstructured.NestedString(u.Object, "spec", "gatewayClassName"); found {
+			g.LinkIfExists(clusterKey(gatewayClassType, gatewayClassName), key, relationshipInstanceOf)
+		}
+
+	case httpRouteType, grpcRouteType:
+		// Link domains to routes, sharing domain nodes with ingresses
+		hostnames, _, _ := unstructured.NestedStringSlice(u.Object, "spec", "hostnames")
+		for _, hostname := range hostnames {
+			g.AddLink(addDomain(g, hostname), key, relationshipAccesses)
+		}
+
+		// Link gateways to the routes attached to them
+		parentRefs, _, _ := unstructured.NestedSlice(u.Object, "spec", "parentRefs")
+		for _, p := range parentRefs {
+			parentRef, ok := p.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if kind, found, _ := unstructured.NestedString(parentRef, "kind"); found && kind != "Gateway" {
+				continue
+			}
+			name, namespace := refNameAndNamespace(parentRef, u.GetNamespace())
+			g.LinkIfExists(namespacedKey(gatewayType, namespace, name), key, relationshipRoutes)
+		}
+
+		// Link routes to their backend services. Services in other namespaces
+		// need a ReferenceGrant, they are linked in FinalizeGraph.
+		for _, ref := range routeBackendRefs(u) {
+			if kind, found, _ := unstructured.NestedString(ref, "kind"); found && kind != "Service" {
+				continue
+			}
+			if group, found, _ := unstructured.NestedString(ref, "group"); found && group != "" {
+				continue
+			}
+			name, namespace := refNameAndNamespace(ref, u.GetNamespace())
+			if namespace == u.GetNamespace() {
+				g.LinkIfExists(key, namespacedKey(serviceType, namespace, name), relationshipRoutes)
+				continue
+			}
+			g.crossNamespaceBackends = append(g.crossNamespaceBackends, backendRef{
+				route:         key,
+				routeKind:     u.GetKind(),
+				routeNodeType: gc.nodeType,
+				fromNamespace: u.GetNamespace(),
+				namespace:     namespace,
+				name:          name,
+			})
+		}
+	}
+}
+
+// FinalizeGraph links routes to the services in other namespaces a
+// ReferenceGrant allows them to reference. The others are listed in the
+// route's unresolved_backends.
+func (gc gatewayAPICollector) FinalizeGraph(g *GraphBuilder) {
+	for _, ref := range g.crossNamespaceBackends {
+		if ref.routeNodeType != gc.nodeType {
+			continue
+		}
+		serviceKey := namespacedKey(serviceType, ref.namespace, ref.name)
+		if ref.granted(g.referenceGrants[ref.namespace]) {
+			g.LinkIfExists(ref.route, serviceKey, relationshipRoutes)
+			continue
+		}
+		if route := g.Node(ref.route); route != nil {
+			unresolved, _ := route.ResourceInfo["unresolved_backends"].([]string)
+			route.ResourceInfo["unresolved_backends"] = append(unresolved, ref.namespace+"/"+ref.name)
+		}
+	}
+}
+
+// backendRef is a reference from a route to a service in another namespace
+type backendRef struct {
+	route         string
+	routeKind     string
+	routeNodeType string
+	fromNamespace string
+	namespace     string
+	name          string
+}
+
+// granted reports whether one of grants, the ReferenceGrants in the
+// service's namespace, allows the reference
+func (ref backendRef) granted(grants []*unstructured.Unstructured) bool {
+	for _, grant := range grants {
+		if grantMatches(grant, "from", func(from map[string]interface{}) bool {
+			group, _, _ := unstructured.NestedString(from, "group")
+			kind, _, _ := unstructured.NestedString(from, "kind")
+			namespace, _, _ := unstructured.NestedString(from, "namespace")
+			return group == gatewayGroup && kind == ref.routeKind && namespace == ref.fromNamespace
+		}) && grantMatches(grant, "to", func(to map[string]interface{}) bool {
+			group, _, _ := unstructured.NestedString(to, "group")
+			kind, _, _ := unstructured.NestedString(to, "kind")
+			name, found, _ := unstructured.NestedString(to, "name")
+			return group == "" && kind == "Service" && (!found || name == "" || name == ref.name)
+		}) {
+			return true
+		}
+	}
+	return false
+}
+
+// grantMatches reports whether any entry of the grant's spec.from or spec.to
+// list satisfies match
+func grantMatches(grant *unstructured.Unstructured, field string, match func(map[string]interface{}) bool) bool {
+	entries, _, _ := unstructured.NestedSlice(grant.Object, "spec", field)
+	for _, e := range entries {
+		if entry, ok := e.(map[string]interface{}); ok && match(entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// referenceGrantCollector records the ReferenceGrants that allow routes to
+// reference services in other namespaces. They aren't rendered as nodes.
+type referenceGrantCollector struct {
+	gatewayAPICollector
+}
+
+func (referenceGrantCollector) BuildNode(obj interface{}) *kutype.Node { return nil }
+
+func (referenceGrantCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		g.referenceGrants[u.GetNamespace()] = append(g.referenceGrants[u.GetNamespace()], u)
+	}
+}
+
+// FinalizeGraph does nothing, the route collectors resolve their backends
+// against the recorded grants
+func (referenceGrantCollector) FinalizeGraph(g *GraphBuilder) {}
+
+// routeBackendRefs returns the backend references of all rules of a route
+func routeBackendRefs(u *unstructured.Unstructured) []map[string]interface{} {
+	backendRefs := make([]map[string]interface{}, 0)
+	rules, _, _ := unstructured.NestedSlice(u.Object, "spec", "rules")
+	for _, r := range rules {
+		rule, ok := r.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		refs, _, _ := unstructured.NestedSlice(rule, "backendRefs")
+		for _, ref := range refs {
+			if backendRef, ok := ref.(map[string]interface{}); ok {
+				backendRefs = append(backendRefs, backendRef)
+			}
+		}
+	}
+	return backendRefs
+}
+
+// refNameAndNamespace returns the target of a Gateway API object reference,
+// which defaults to the namespace of the referencing object
+func refNameAndNamespace(ref map[string]interface{}, defaultNamespace string) (string, string) {
+	name, _, _ := unstructured.NestedString(ref, "name")
+	namespace, found, _ := unstructured.NestedString(ref, "namespace")
+	if !found || namespace == "" {
+		namespace = defaultNamespace
+	}
+	return name, namespace
+}
+
+// trueConditions returns the types of the conditions at fields whose status is True
+func trueConditions(obj map[string]interface{}, fields ...string) []string {
+	conditions := make([]string, 0)
+	list, _, _ := unstructured.NestedSlice(obj, fields...)
+	for _, c := range list {
+		condition, ok := c.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if status, _, _ := unstructured.NestedString(condition, "status"); status == "True" {
+			conditionType, _, _ := unstructured.NestedString(condition, "type")
+			conditions = append(conditions, conditionType)
+		}
+	}
+	return conditions
+}
+
+// conditionStatus returns ready if it is among conditions, Pending otherwise
+func conditionStatus(conditions []string, ready string) string {
+	for _, condition := range conditions {
+		if condition == ready {
+			return ready
+		}
+	}
+	return "Pending"
+}
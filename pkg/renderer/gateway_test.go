@@ -0,0 +1,76 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestRouteBackendsInOtherNamespacesNeedReferenceGrant(t *testing.T) {
+	route := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayGroup + "/v1",
+		"kind":       "HTTPRoute",
+		"metadata":   map[string]interface{}{"name": "web", "namespace": "frontend"},
+		"spec": map[string]interface{}{
+			"rules": []interface{}{map[string]interface{}{
+				"backendRefs": []interface{}{
+					map[string]interface{}{"name": "web"},
+					map[string]interface{}{"name": "api", "namespace": "backend"},
+					map[string]interface{}{"name": "db", "namespace": "backend"},
+				},
+			}},
+		},
+	}}
+	grant := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": gatewayGroup + "/v1beta1",
+		"kind":       "ReferenceGrant",
+		"metadata":   map[string]interface{}{"name": "frontend-api", "namespace": "backend"},
+		"spec": map[string]interface{}{
+			"from": []interface{}{map[string]interface{}{"group": gatewayGroup, "kind": "HTTPRoute", "namespace": "frontend"}},
+			"to":   []interface{}{map[string]interface{}{"group": "", "kind": "Service", "name": "api"}},
+		},
+	}}
+
+	routes := gatewayAPICollector{resource: "httproutes", nodeType: httpRouteType}
+	grants := referenceGrantCollector{gatewayAPICollector{resource: "referencegrants"}}
+
+	g := newGraphBuilder()
+	g.AddNode(routes.BuildNode(route))
+	for _, service := range []struct{ namespace, name string }{{"frontend", "web"}, {"backend", "api"}, {"backend", "db"}} {
+		g.AddNode(&kutype.Node{Id: namespacedKey(serviceType, service.namespace, service.name), Type: serviceType})
+	}
+	routes.BuildLinks(route, g)
+	grants.BuildLinks(grant, g)
+	routes.FinalizeGraph(g)
+
+	routeKey := namespacedKey(httpRouteType, "frontend", "web")
+	linked := make([]string, 0)
+	for _, link := range g.Links() {
+		if link.Source == routeKey {
+			linked = append(linked, link.Target)
+		}
+	}
+	want := []string{namespacedKey(serviceType, "frontend", "web"), namespacedKey(serviceType, "backend", "api")}
+	if !reflect.DeepEqual(linked, want) {
+		t.Errorf("route links to %v, want %v", linked, want)
+	}
+	if unresolved := g.Node(routeKey).ResourceInfo["unresolved_backends"]; !reflect.DeepEqual(unresolved, []string{"backend/db"}) {
+		t.Errorf("unresolved_backends = %v, want [backend/db]", unresolved)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// Node ids have the form type/name for cluster-scoped and type/namespace/name
+// for namespaced resources. Every segment is path-escaped, so no two objects
+// share an id and ParseID can split an id back into its parts.
+
+// clusterKey returns the node id of a cluster-scoped resource
+func clusterKey(nodeType, name string) string {
+	return url.PathEscape(nodeType) + "/" + url.PathEscape(name)
+}
+
+// namespacedKey returns the node id of a namespaced resource
+func namespacedKey(nodeType, namespace, name string) string {
+	return url.PathEscape(nodeType) + "/" + url.PathEscape(namespace) + "/" + url.PathEscape(name)
+}
+
+// NodeID returns the id of the node for an object, namespace is empty for
+// cluster-scoped resources. Collectors registered outside this package use it
+// to link to built-in nodes, e.g. NodeID("pod", "default", "web-0").
+func NodeID(nodeType, namespace, name string) string {
+	if namespace == "" {
+		return clusterKey(nodeType, name)
+	}
+	return namespacedKey(nodeType, namespace, name)
+}
+
+// ParseID returns the type, namespace and name a node id was built from. The
+// namespace is empty for cluster-scoped resources.
+func ParseID(id string) (nodeType, namespace, name string, err error) {
+	segments := strings.Split(id, "/")
+	unescaped := make([]string, len(segments))
+	for i, segment := range segments {
+		if unescaped[i], err = url.PathUnescape(segment); err != nil {
+			return "", "", "", fmt.Errorf("invalid node id %q: %s", id, err)
+		}
+	}
+
+	switch len(unescaped) {
+	case 2:
+		return unescaped[0], "", unescaped[1], nil
+	case 3:
+		return unescaped[0], unescaped[1], unescaped[2], nil
+	default:
+		return "", "", "", fmt.Errorf("invalid node id %q: expected type/name or type/namespace/name", id)
+	}
+}
+
+// LegacyID returns the hyphenated id a node had before ids were escaped, e.g.
+// pod-default-web for pod/default/web. Legacy ids are ambiguous, they are only
+// meant for consumers that have not moved to the new format yet.
+func LegacyID(id string) string {
+	nodeType, namespace, name, err := ParseID(id)
+	if err != nil {
+		return id
+	}
+	if namespace == "" {
+		return fmt.Sprintf("%s-%s", nodeType, name)
+	}
+	return fmt.Sprintf("%s-%s-%s", nodeType, namespace, name)
+}
+
+// UseLegacyIDs rewrites the node ids and link ends of graph to legacy ids
+func UseLegacyIDs(graph *kutype.Graph) {
+	if graph.Nodes != nil {
+		for i := range *graph.Nodes {
+			(*graph.Nodes)[i].Id = LegacyID((*graph.Nodes)[i].Id)
+		}
+	}
+	if graph.Links != nil {
+		for i := range *graph.Links {
+			link := &(*graph.Links)[i]
+			link.Source = LegacyID(link.Source)
+			link.Target = LegacyID(link.Target)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// The metrics API is served by metrics-server when it is installed. It can't
+// be watched, so usage is polled instead of cached by an informer.
+var (
+	podMetricsResource  = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "pods"}
+	nodeMetricsResource = schema.GroupVersionResource{Group: "metrics.k8s.io", Version: "v1beta1", Resource: "nodes"}
+)
+
+// usage is the CPU and memory a pod or node is currently using
+type usage struct {
+	cpuMillicores int64
+	memoryBytes   int64
+}
+
+// metricsSource keeps the latest pod and node usage reported by the metrics API
+type metricsSource struct {
+	client   dynamic.Interface
+	interval time.Duration
+
+	mu sync.RWMutex
+	// usage maps node ids to their latest usage
+	usage map[string]usage
+}
+
+func newMetricsSource(client dynamic.Interface, interval time.Duration) *metricsSource {
+	return &metricsSource{
+		client:   client,
+		interval: interval,
+		usage:    make(map[string]usage),
+	}
+}
+
+// run refreshes the usage every interval until ctx is done and calls notify
+// whenever it changed
+func (m *metricsSource) run(ctx context.Context, notify func()) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			changed, err := m.refresh(ctx)
+			if err != nil {
+				log.Printf("Failed to refresh metrics: %s", err)
+				continue
+			}
+			if changed {
+				notify()
+			}
+		}
+	}
+}
+
+// refresh lists the current pod and node metrics and reports whether they
+// differ from the previous ones
+func (m *metricsSource) refresh(ctx context.Context) (bool, error) {
+	latest := make(map[string]usage)
+
+	podMetrics, err := m.client.Resource(podMetricsResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, item := range podMetrics.Items {
+		// Pod usage is reported per container
+		var podUsage usage
+		containers, _, _ := unstructured.NestedSlice(item.Object, "containers")
+		for _, c := range containers {
+			if container, ok := c.(map[string]interface{}); ok {
+				containerUsage := parseUsage(container)
+				podUsage.cpuMillicores += containerUsage.cpuMillicores
+				podUsage.memoryBytes += containerUsage.memoryBytes
+			}
+		}
+		latest[namespacedKey(podType, item.GetNamespace(), item.GetName())] = podUsage
+	}
+
+	nodeMetrics, err := m.client.Resource(nodeMetricsResource).List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+	for _, item := range nodeMetrics.Items {
+		latest[clusterKey(nodeType, item.GetName())] = parseUsage(item.Object)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := len(latest) != len(m.usage)
+	for key, u := range latest {
+		if previous, exists := m.usage[key]; !exists || previous != u {
+			changed = true
+			break
+		}
+	}
+	m.usage = latest
+	return changed, nil
+}
+
+// parseUsage reads the usage field of a pod container or node metrics object
+func parseUsage(obj map[string]interface{}) usage {
+	var u usage
+	if cpu, found, _ := unstructured.NestedString(obj, "usage", "cpu"); found {
+		if quantity, err := resource.ParseQuantity(cpu); err == nil {
+			u.cpuMillicores = quantity.MilliValue()
+		}
+	}
+	if memory, found, _ := unstructured.NestedString(obj, "usage", "memory"); found {
+		if quantity, err := resource.ParseQuantity(memory); err == nil {
+			u.memoryBytes = quantity.Value()
+		}
+	}
+	return u
+}
+
+// addUsage adds the latest usage to the pods and nodes of the graph, relative
+// to the requests of pods and the allocatable resources of nodes
+func (m *metricsSource) addUsage(g *GraphBuilder) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	for key, u := range m.usage {
+		node := g.Node(key)
+		if node == nil {
+			continue
+		}
+		resourceInfo := node.ResourceInfo
+		resourceInfo["cpu_usage"] = resource.NewMilliQuantity(u.cpuMillicores, resource.DecimalSI).String()
+		resourceInfo["memory_usage"] = resource.NewQuantity(u.memoryBytes, resource.BinarySI).String()
+		resourceInfo["cpu_usage_millicores"] = u.cpuMillicores
+		resourceInfo["memory_usage_bytes"] = u.memoryBytes
+
+		switch node.Type {
+		case podType:
+			// Pods without requests have no meaningful percentage
+			if cpuRequests, _ := resourceInfo["cpu_requests_millicores"].(int64); cpuRequests > 0 {
+				resourceInfo["cpu_usage_percent_of_request"] = percentOf(u.cpuMillicores, cpuRequests)
+			}
+			if memoryRequests, _ := resourceInfo["memory_requests_bytes"].(int64); memoryRequests > 0 {
+				resourceInfo["memory_usage_percent_of_request"] = percentOf(u.memoryBytes, memoryRequests)
+			}
+		case nodeType:
+			cpuAllocatable, _ := resourceInfo["cpu_allocatable_millicores"].(int64)
+			memoryAllocatable, _ := resourceInfo["memory_allocatable_bytes"].(int64)
+			resourceInfo["cpu_usage_percent_of_allocatable"] = percentOf(u.cpuMillicores, cpuAllocatable)
+			resourceInfo["memory_usage_percent_of_allocatable"] = percentOf(u.memoryBytes, memoryAllocatable)
+		}
+	}
+}
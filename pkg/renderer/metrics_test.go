@@ -0,0 +1,337 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+)
+
+// fakeMetricsAPI serves discovery and the pod and node lists of the metrics
+// API. With served unset the cluster behaves as if metrics-server is missing.
+type fakeMetricsAPI struct {
+	served bool
+
+	mu         sync.Mutex
+	podItems   []interface{}
+	nodeItems  []interface{}
+	listErrors bool
+}
+
+func (f *fakeMetricsAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var body interface{}
+	switch {
+	case !f.served:
+		http.NotFound(w, r)
+		return
+	case r.URL.Path == "/apis/metrics.k8s.io/v1beta1":
+		body = map[string]interface{}{
+			"kind":         "APIResourceList",
+			"apiVersion":   "v1",
+			"groupVersion": "metrics.k8s.io/v1beta1",
+			"resources": []interface{}{
+				map[string]interface{}{"name": "pods", "namespaced": true, "kind": "PodMetrics", "verbs": []string{"get", "list"}},
+				map[string]interface{}{"name": "nodes", "namespaced": false, "kind": "NodeMetrics", "verbs": []string{"get", "list"}},
+			},
+		}
+	case f.listErrors:
+		http.Error(w, "metrics unavailable", http.StatusServiceUnavailable)
+		return
+	case r.URL.Path == "/apis/metrics.k8s.io/v1beta1/pods":
+		body = metricsList("PodMetricsList", f.podItems)
+	case r.URL.Path == "/apis/metrics.k8s.io/v1beta1/nodes":
+		body = metricsList("NodeMetricsList", f.nodeItems)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		panic(err)
+	}
+}
+
+func (f *fakeMetricsAPI) setPods(items ...interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.podItems = items
+}
+
+func metricsList(kind string, items []interface{}) map[string]interface{} {
+	if items == nil {
+		items = []interface{}{}
+	}
+	return map[string]interface{}{
+		"kind":       kind,
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"metadata":   map[string]interface{}{},
+		"items":      items,
+	}
+}
+
+func podMetrics(namespace, name string, containers ...map[string]string) map[string]interface{} {
+	list := make([]interface{}, 0, len(containers))
+	for i, usage := range containers {
+		list = append(list, map[string]interface{}{
+			"name":  fmt.Sprintf("container-%d", i),
+			"usage": map[string]interface{}{"cpu": usage["cpu"], "memory": usage["memory"]},
+		})
+	}
+	return map[string]interface{}{
+		"kind":       "PodMetrics",
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"metadata":   map[string]interface{}{"name": name, "namespace": namespace},
+		"containers": list,
+	}
+}
+
+func nodeMetrics(name, cpu, memory string) map[string]interface{} {
+	return map[string]interface{}{
+		"kind":       "NodeMetrics",
+		"apiVersion": "metrics.k8s.io/v1beta1",
+		"metadata":   map[string]interface{}{"name": name},
+		"usage":      map[string]interface{}{"cpu": cpu, "memory": memory},
+	}
+}
+
+func newMetricsServer(t *testing.T, api *fakeMetricsAPI) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(api)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestParseUsage(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  map[string]interface{}
+		want usage
+	}{
+		{
+			name: "millicores and binary memory",
+			obj:  map[string]interface{}{"usage": map[string]interface{}{"cpu": "250m", "memory": "128Mi"}},
+			want: usage{cpuMillicores: 250, memoryBytes: 128 * 1024 * 1024},
+		},
+		{
+			name: "whole cores",
+			obj:  map[string]interface{}{"usage": map[string]interface{}{"cpu": "2", "memory": "1Gi"}},
+			want: usage{cpuMillicores: 2000, memoryBytes: 1024 * 1024 * 1024},
+		},
+		{
+			name: "nanocores round up",
+			obj:  map[string]interface{}{"usage": map[string]interface{}{"cpu": "1500000n", "memory": "1000"}},
+			want: usage{cpuMillicores: 2, memoryBytes: 1000},
+		},
+		{
+			name: "missing usage",
+			obj:  map[string]interface{}{},
+			want: usage{},
+		},
+		{
+			name: "invalid quantities",
+			obj:  map[string]interface{}{"usage": map[string]interface{}{"cpu": "lots", "memory": "??"}},
+			want: usage{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseUsage(tt.obj); got != tt.want {
+				t.Errorf("parseUsage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMetricsRefresh(t *testing.T) {
+	api := &fakeMetricsAPI{served: true}
+	api.podItems = []interface{}{
+		podMetrics("default", "web-0", map[string]string{"cpu": "100m", "memory": "64Mi"}, map[string]string{"cpu": "50m", "memory": "16Mi"}),
+	}
+	api.nodeItems = []interface{}{nodeMetrics("worker-1", "1500m", "2Gi")}
+	server := newMetricsServer(t, api)
+
+	client, err := dynamic.NewForConfig(&rest.Config{Host: server.URL})
+	if err != nil {
+		t.Fatalf("failed to create dynamic client: %s", err)
+	}
+	m := newMetricsSource(client, time.Minute)
+	ctx := context.Background()
+
+	changed, err := m.refresh(ctx)
+	if err != nil {
+		t.Fatalf("refresh failed: %s", err)
+	}
+	if !changed {
+		t.Errorf("first refresh reported no change")
+	}
+	wantPod := usage{cpuMillicores: 150, memoryBytes: 80 * 1024 * 1024}
+	if got := m.usage[namespacedKey(podType, "default", "web-0")]; got != wantPod {
+		t.Errorf("pod usage = %+v, want the sum of its containers %+v", got, wantPod)
+	}
+	wantNode := usage{cpuMillicores: 1500, memoryBytes: 2 * 1024 * 1024 * 1024}
+	if got := m.usage[clusterKey(nodeType, "worker-1")]; got != wantNode {
+		t.Errorf("node usage = %+v, want %+v", got, wantNode)
+	}
+
+	if changed, err := m.refresh(ctx); err != nil || changed {
+		t.Errorf("refresh without new usage = %v, %v, want no change", changed, err)
+	}
+
+	api.setPods(podMetrics("default", "web-0", map[string]string{"cpu": "300m", "memory": "64Mi"}))
+	if changed, err := m.refresh(ctx); err != nil || !changed {
+		t.Errorf("refresh with new usage = %v, %v, want a change", changed, err)
+	}
+
+	api.setPods()
+	if changed, err := m.refresh(ctx); err != nil || !changed {
+		t.Errorf("refresh after a pod disappeared = %v, %v, want a change", changed, err)
+	}
+	if _, exists := m.usage[namespacedKey(podType, "default", "web-0")]; exists {
+		t.Errorf("usage of a deleted pod was kept")
+	}
+
+	api.mu.Lock()
+	api.listErrors = true
+	api.mu.Unlock()
+	if _, err := m.refresh(ctx); err == nil {
+		t.Errorf("refresh succeeded although the metrics API failed")
+	}
+	if _, exists := m.usage[clusterKey(nodeType, "worker-1")]; !exists {
+		t.Errorf("a failed refresh dropped the previous usage")
+	}
+}
+
+func TestAddUsage(t *testing.T) {
+	g := newGraphBuilder()
+	g.AddNode(&kutype.Node{Id: namespacedKey(podType, "default", "web-0"), Type: podType, ResourceInfo: map[string]interface{}{
+		"cpu_requests_millicores": int64(200),
+		"memory_requests_bytes":   int64(0),
+	}})
+	g.AddNode(&kutype.Node{Id: clusterKey(nodeType, "worker-1"), Type: nodeType, ResourceInfo: map[string]interface{}{
+		"cpu_allocatable_millicores": int64(4000),
+		"memory_allocatable_bytes":   int64(8 * 1024 * 1024 * 1024),
+	}})
+
+	m := newMetricsSource(nil, time.Minute)
+	m.usage = map[string]usage{
+		namespacedKey(podType, "default", "web-0"):  {cpuMillicores: 100, memoryBytes: 64 * 1024 * 1024},
+		clusterKey(nodeType, "worker-1"):            {cpuMillicores: 1000, memoryBytes: 2 * 1024 * 1024 * 1024},
+		namespacedKey(podType, "default", "absent"): {cpuMillicores: 1, memoryBytes: 1},
+	}
+	m.addUsage(g)
+
+	pod := g.Node(namespacedKey(podType, "default", "web-0")).ResourceInfo
+	for key, want := range map[string]interface{}{
+		"cpu_usage":                    "100m",
+		"memory_usage":                 "64Mi",
+		"cpu_usage_millicores":         int64(100),
+		"memory_usage_bytes":           int64(64 * 1024 * 1024),
+		"cpu_usage_percent_of_request": percentOf(100, 200),
+	} {
+		if pod[key] != want {
+			t.Errorf("pod %s = %v, want %v", key, pod[key], want)
+		}
+	}
+	if _, exists := pod["memory_usage_percent_of_request"]; exists {
+		t.Errorf("pod without memory requests got a memory usage percentage")
+	}
+
+	node := g.Node(clusterKey(nodeType, "worker-1")).ResourceInfo
+	for key, want := range map[string]interface{}{
+		"cpu_usage":                           "1",
+		"memory_usage":                        "2Gi",
+		"cpu_usage_percent_of_allocatable":    percentOf(1000, 4000),
+		"memory_usage_percent_of_allocatable": percentOf(2, 8),
+	} {
+		if node[key] != want {
+			t.Errorf("node %s = %v, want %v", key, node[key], want)
+		}
+	}
+
+	if g.HasNode(namespacedKey(podType, "default", "absent")) {
+		t.Errorf("usage of a pod missing from the graph added a node")
+	}
+}
+
+func TestNewCacheMetrics(t *testing.T) {
+	tests := []struct {
+		name        string
+		served      bool
+		interval    time.Duration
+		wantMetrics bool
+	}{
+		{name: "metrics API served", served: true, interval: time.Minute, wantMetrics: true},
+		{name: "metrics API absent", served: false, interval: time.Minute, wantMetrics: false},
+		{name: "metrics disabled", served: true, interval: 0, wantMetrics: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newMetricsServer(t, &fakeMetricsAPI{served: tt.served})
+			c, err := NewCache(Options{
+				Kubeconfig:      writeKubeconfig(t, server.URL),
+				Collectors:      []string{"pods", "nodes"},
+				MetricsInterval: tt.interval,
+			})
+			if err != nil {
+				t.Fatalf("NewCache failed: %s", err)
+			}
+			if got := c.metrics != nil; got != tt.wantMetrics {
+				t.Errorf("metrics enabled = %v, want %v", got, tt.wantMetrics)
+			}
+		})
+	}
+}
+
+// writeKubeconfig writes a kubeconfig for server and returns its path
+func writeKubeconfig(t *testing.T, server string) string {
+	t.Helper()
+	t.Setenv("KUBERNETES_SERVICE_HOST", "")
+	kubeconfig := fmt.Sprintf(`apiVersion: v1
+kind: Config
+clusters:
+- name: fake
+  cluster:
+    server: %s
+contexts:
+- name: fake
+  context:
+    cluster: fake
+    user: fake
+current-context: fake
+users:
+- name: fake
+  user: {}
+`, server)
+	path := filepath.Join(t.TempDir(), "kubeconfig")
+	if err := os.WriteFile(path, []byte(kubeconfig), 0o600); err != nil {
+		t.Fatalf("failed to write kubeconfig: %s", err)
+	}
+	return path
+}
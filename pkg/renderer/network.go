@@ -0,0 +1,433 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	RegisterCollector(ingressCollector{})
+	RegisterCollector(endpointSliceCollector{})
+	RegisterCollector(networkPolicyCollector{})
+}
+
+type ingressCollector struct{}
+
+func (ingressCollector) Name() string { return "ingresses" }
+
+func (ingressCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Networking().V1().Ingresses().Informer(), nil
+}
+
+func (ingressCollector) BuildNode(obj interface{}) *kutype.Node {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return nil
+	}
+	ingressKey := namespacedKey(ingressType, ing.Namespace, ing.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["rules"] = len(ing.Spec.Rules)
+	resourceInfo["tls"] = len(ing.Spec.TLS)
+
+	// Ingress class
+	if ing.Spec.IngressClassName != nil {
+		resourceInfo["ingress_class"] = *ing.Spec.IngressClassName
+	}
+
+	// Load balancer info
+	if len(ing.Status.LoadBalancer.Ingress) > 0 {
+		lbIngress := ing.Status.LoadBalancer.Ingress[0]
+		if lbIngress.IP != "" {
+			resourceInfo["load_balancer_ip"] = lbIngress.IP
+		}
+		if lbIngress.Hostname != "" {
+			resourceInfo["load_balancer_hostname"] = lbIngress.Hostname
+		}
+	}
+
+	return &kutype.Node{
+		Id:           ingressKey,
+		Name:         ing.Name,
+		Type:         ingressType,
+		Namespace:    ing.Namespace,
+		CreationTime: ing.CreationTimestamp.Format(time.RFC3339),
+		Labels:       ing.Labels,
+		Annotations:  ing.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (ingressCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	ing, ok := obj.(*networkingv1.Ingress)
+	if !ok {
+		return
+	}
+	ingressKey := namespacedKey(ingressType, ing.Namespace, ing.Name)
+
+	// Create domain nodes for each host and link ingresses to services
+	for _, rule := range ing.Spec.Rules {
+		// Link domain to ingress
+		if rule.Host != "" {
+			g.AddLink(addDomain(g, rule.Host), ingressKey, relationshipAccesses)
+		}
+
+		// Link ingresses to services
+		if rule.HTTP != nil {
+			for _, path := range rule.HTTP.Paths {
+				if path.Backend.Service != nil {
+					serviceKey := namespacedKey(serviceType, ing.Namespace, path.Backend.Service.Name)
+					g.LinkIfExists(ingressKey, serviceKey, relationshipRoutes)
+				}
+			}
+		}
+	}
+}
+
+// addDomain adds the domain node for a hostname unless it exists and returns
+// its id. Ingresses and Gateway API routes share domain nodes.
+func addDomain(g *GraphBuilder, host string) string {
+	domainKey := clusterKey(domainType, host)
+	if g.HasNode(domainKey) {
+		return domainKey
+	}
+
+	domainResourceInfo := make(map[string]interface{})
+	domainResourceInfo["hostname"] = host
+	domainResourceInfo["type"] = "external_domain"
+	domainResourceInfo["description"] = fmt.Sprintf("External domain: %s", host)
+
+	g.AddNode(&kutype.Node{
+		Id:           domainKey,
+		Name:         host,
+		Type:         domainType,
+		Namespace:    "", // Domains are cluster-wide
+		Labels:       make(map[string]string),
+		Annotations:  make(map[string]string),
+		ResourceInfo: domainResourceInfo,
+	})
+	return domainKey
+}
+
+type endpointSliceCollector struct{}
+
+func (endpointSliceCollector) Name() string { return "endpointslices" }
+
+func (endpointSliceCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Discovery().V1().EndpointSlices().Informer(), nil
+}
+
+func (endpointSliceCollector) BuildNode(obj interface{}) *kutype.Node {
+	es, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return nil
+	}
+	esKey := namespacedKey(endpointSliceType, es.Namespace, es.Name)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["address_type"] = string(es.AddressType)
+	resourceInfo["endpoints"] = len(es.Endpoints)
+	resourceInfo["ports"] = len(es.Ports)
+
+	return &kutype.Node{
+		Id:           esKey,
+		Name:         es.Name,
+		Type:         endpointSliceType,
+		Namespace:    es.Namespace,
+		CreationTime: es.CreationTimestamp.Format(time.RFC3339),
+		Labels:       es.Labels,
+		Annotations:  es.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (endpointSliceCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	es, ok := obj.(*discoveryv1.EndpointSlice)
+	if !ok {
+		return
+	}
+	esKey := namespacedKey(endpointSliceType, es.Namespace, es.Name)
+
+	// Link endpoint slices to services
+	if serviceName, ok := es.Labels["kubernetes.io/service-name"]; ok {
+		serviceKey := namespacedKey(serviceType, es.Namespace, serviceName)
+		g.LinkIfExists(serviceKey, esKey, relationshipExposes)
+	}
+
+	// Link endpoint slices to pods
+	for _, endpoint := range es.Endpoints {
+		if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+			podKey := namespacedKey(podType, es.Namespace, endpoint.TargetRef.Name)
+			g.LinkIfExists(esKey, podKey, relationshipExposes)
+		}
+	}
+}
+
+type networkPolicyCollector struct{}
+
+func (networkPolicyCollector) Name() string { return "networkpolicies" }
+
+func (networkPolicyCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Networking().V1().NetworkPolicies().Informer(), nil
+}
+
+func (networkPolicyCollector) BuildNode(obj interface{}) *kutype.Node {
+	np, ok := obj.(*networkingv1.NetworkPolicy)
+	if !ok {
+		return nil
+	}
+	npKey := namespacedKey(networkPolicyType, np.Namespace, np.Name)
+
+	policyTypes := make([]string, 0, len(np.Spec.PolicyTypes))
+	for _, policyType := range effectivePolicyTypes(np) {
+		policyTypes = append(policyTypes, string(policyType))
+	}
+
+	// IP blocks can't be matched against collected objects, count them instead
+	ipBlocks := 0
+	for _, rule := range np.Spec.Ingress {
+		ipBlocks += countIPBlocks(rule.From)
+	}
+	for _, rule := range np.Spec.Egress {
+		ipBlocks += countIPBlocks(rule.To)
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["pod_selector"] = metav1.FormatLabelSelector(&np.Spec.PodSelector)
+	resourceInfo["policy_types"] = policyTypes
+	resourceInfo["ingress_rules"] = len(np.Spec.Ingress)
+	resourceInfo["egress_rules"] = len(np.Spec.Egress)
+	resourceInfo["ip_blocks"] = ipBlocks
+
+	// A rule without peers allows all traffic, it has no peers to link to
+	isolates := make(map[networkingv1.PolicyType]bool)
+	for _, policyType := range effectivePolicyTypes(np) {
+		isolates[policyType] = true
+	}
+	allowsAllIngress := false
+	for _, rule := range np.Spec.Ingress {
+		allowsAllIngress = allowsAllIngress || len(rule.From) == 0
+	}
+	allowsAllEgress := false
+	for _, rule := range np.Spec.Egress {
+		allowsAllEgress = allowsAllEgress || len(rule.To) == 0
+	}
+	resourceInfo["allows_all_ingress"] = isolates[networkingv1.PolicyTypeIngress] && allowsAllIngress
+	resourceInfo["allows_all_egress"] = isolates[networkingv1.PolicyTypeEgress] && allowsAllEgress
+
+	return &kutype.Node{
+		Id:           npKey,
+		Name:         np.Name,
+		Type:         networkPolicyType,
+		Namespace:    np.Namespace,
+		CreationTime: np.CreationTimestamp.Format(time.RFC3339),
+		Labels:       np.Labels,
+		Annotations:  np.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+// BuildLinks records the policy, it is linked in FinalizeGraph once the pods
+// and namespaces it can select are indexed
+func (networkPolicyCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	if np, ok := obj.(*networkingv1.NetworkPolicy); ok {
+		g.networkPolicies = append(g.networkPolicies, np)
+	}
+}
+
+// FinalizeGraph links the recorded policies to the pods they isolate and the
+// peers their rules allow, then flags which of the pods are restricted
+func (networkPolicyCollector) FinalizeGraph(g *GraphBuilder) {
+	index := newPolicyIndex(g)
+	for _, np := range g.networkPolicies {
+		linkPolicy(g, index, np)
+	}
+
+	for _, pods := range index.pods {
+		for _, pod := range pods {
+			ingressRestricted, _ := pod.ResourceInfo["ingress_restricted"].(bool)
+			egressRestricted, _ := pod.ResourceInfo["egress_restricted"].(bool)
+			pod.ResourceInfo["ingress_restricted"] = ingressRestricted
+			pod.ResourceInfo["egress_restricted"] = egressRestricted
+			pod.ResourceInfo["unrestricted"] = !ingressRestricted && !egressRestricted
+		}
+	}
+}
+
+// linkPolicy links a network policy to the pods it isolates and to the peers
+// its rules allow
+func linkPolicy(g *GraphBuilder, index *policyIndex, np *networkingv1.NetworkPolicy) {
+	npKey := namespacedKey(networkPolicyType, np.Namespace, np.Name)
+
+	podSelector, err := metav1.LabelSelectorAsSelector(&np.Spec.PodSelector)
+	if err != nil {
+		return
+	}
+
+	// Link network policies to the pods they isolate
+	isolates := make(map[networkingv1.PolicyType]bool)
+	for _, policyType := range effectivePolicyTypes(np) {
+		isolates[policyType] = true
+	}
+	for _, pod := range index.selectPods(np.Namespace, podSelector) {
+		g.AddLink(npKey, pod.Id, relationshipAppliesTo)
+		if isolates[networkingv1.PolicyTypeIngress] {
+			pod.ResourceInfo["ingress_restricted"] = true
+		}
+		if isolates[networkingv1.PolicyTypeEgress] {
+			pod.ResourceInfo["egress_restricted"] = true
+		}
+	}
+
+	// Link network policies to the peers their rules allow
+	if isolates[networkingv1.PolicyTypeIngress] {
+		for _, rule := range np.Spec.Ingress {
+			for _, peer := range index.resolvePeers(np.Namespace, rule.From) {
+				g.AddLink(npKey, peer, relationshipAllowsIngressFrom)
+			}
+		}
+	}
+	if isolates[networkingv1.PolicyTypeEgress] {
+		for _, rule := range np.Spec.Egress {
+			for _, peer := range index.resolvePeers(np.Namespace, rule.To) {
+				g.AddLink(npKey, peer, relationshipAllowsEgressTo)
+			}
+		}
+	}
+}
+
+// effectivePolicyTypes returns the policy types of np, defaulted the way the
+// API server does for policies that don't list them
+func effectivePolicyTypes(np *networkingv1.NetworkPolicy) []networkingv1.PolicyType {
+	if len(np.Spec.PolicyTypes) > 0 {
+		return np.Spec.PolicyTypes
+	}
+	policyTypes := []networkingv1.PolicyType{networkingv1.PolicyTypeIngress}
+	if len(np.Spec.Egress) > 0 {
+		policyTypes = append(policyTypes, networkingv1.PolicyTypeEgress)
+	}
+	return policyTypes
+}
+
+// countIPBlocks returns how many peers select an IP block
+func countIPBlocks(peers []networkingv1.NetworkPolicyPeer) int {
+	count := 0
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			count++
+		}
+	}
+	return count
+}
+
+// policyIndex holds the pods network policies apply to by namespace and the
+// namespaces by name. It is built once per graph, so resolving a selector only
+// looks at the pods of the namespaces it can match.
+type policyIndex struct {
+	pods       map[string][]*kutype.Node
+	namespaces map[string]*kutype.Node
+}
+
+func newPolicyIndex(g *GraphBuilder) *policyIndex {
+	index := &policyIndex{
+		pods:       make(map[string][]*kutype.Node),
+		namespaces: make(map[string]*kutype.Node),
+	}
+	for _, node := range g.nodes {
+		switch {
+		case node.Type == namespaceType:
+			index.namespaces[node.Name] = node
+		case node.Type == podType && policyApplies(node):
+			index.pods[node.Namespace] = append(index.pods[node.Namespace], node)
+		}
+	}
+	return index
+}
+
+// policyApplies reports whether network policies apply to a pod. Pods on the
+// host network and pods that finished are not isolated by them.
+func policyApplies(pod *kutype.Node) bool {
+	if hostNetwork, _ := pod.ResourceInfo["host_network"].(bool); hostNetwork {
+		return false
+	}
+	return pod.Status != string(corev1.PodSucceeded) && pod.Status != string(corev1.PodFailed)
+}
+
+// resolvePeers returns the ids of the nodes a rule's peers select. A peer
+// with only a namespace selector resolves to the namespaces themselves
+// rather than to every pod in them.
+func (index *policyIndex) resolvePeers(namespace string, peers []networkingv1.NetworkPolicyPeer) []string {
+	ids := make([]string, 0)
+	for _, peer := range peers {
+		if peer.IPBlock != nil {
+			continue
+		}
+
+		podSelector := labels.Everything()
+		if peer.PodSelector != nil {
+			selector, err := metav1.LabelSelectorAsSelector(peer.PodSelector)
+			if err != nil {
+				continue
+			}
+			podSelector = selector
+		}
+
+		if peer.NamespaceSelector == nil {
+			for _, pod := range index.selectPods(namespace, podSelector) {
+				ids = append(ids, pod.Id)
+			}
+			continue
+		}
+
+		namespaceSelector, err := metav1.LabelSelectorAsSelector(peer.NamespaceSelector)
+		if err != nil {
+			continue
+		}
+		for _, ns := range index.namespaces {
+			if !namespaceSelector.Matches(labels.Set(ns.Labels)) {
+				continue
+			}
+			if peer.PodSelector == nil {
+				ids = append(ids, ns.Id)
+				continue
+			}
+			for _, pod := range index.selectPods(ns.Name, podSelector) {
+				ids = append(ids, pod.Id)
+			}
+		}
+	}
+	return ids
+}
+
+// selectPods returns the pods in a namespace whose labels match selector
+func (index *policyIndex) selectPods(namespace string, selector labels.Selector) []*kutype.Node {
+	selected := make([]*kutype.Node, 0)
+	for _, pod := range index.pods[namespace] {
+		if selector.Matches(labels.Set(pod.Labels)) {
+			selected = append(selected, pod)
+		}
+	}
+	return selected
+}
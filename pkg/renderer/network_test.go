@@ -0,0 +1,86 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testPod(name string, phase corev1.PodPhase, hostNetwork bool) *corev1.Pod {
+	return &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default", Labels: map[string]string{"app": "web"}},
+		Spec:       corev1.PodSpec{HostNetwork: hostNetwork},
+		Status:     corev1.PodStatus{Phase: phase},
+	}
+}
+
+func TestNetworkPolicySkipsHostNetworkAndFinishedPods(t *testing.T) {
+	pods := []*corev1.Pod{
+		testPod("running", corev1.PodRunning, false),
+		testPod("host", corev1.PodRunning, true),
+		testPod("succeeded", corev1.PodSucceeded, false),
+		testPod("failed", corev1.PodFailed, false),
+	}
+	policy := &networkingv1.NetworkPolicy{
+		ObjectMeta: metav1.ObjectMeta{Name: "web", Namespace: "default"},
+		Spec: networkingv1.NetworkPolicySpec{
+			PodSelector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+			Ingress: []networkingv1.NetworkPolicyIngressRule{{
+				From: []networkingv1.NetworkPolicyPeer{{PodSelector: &metav1.LabelSelector{}}},
+			}},
+		},
+	}
+
+	g := newGraphBuilder()
+	g.AddNode(namespaceCollector{}.BuildNode(&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "default"}}))
+	for _, pod := range pods {
+		g.AddNode(podCollector{}.BuildNode(pod))
+	}
+	g.AddNode(networkPolicyCollector{}.BuildNode(policy))
+	networkPolicyCollector{}.BuildLinks(policy, g)
+	networkPolicyCollector{}.FinalizeGraph(g)
+
+	policyKey := namespacedKey(networkPolicyType, "default", "web")
+	runningKey := namespacedKey(podType, "default", "running")
+	linked := make(map[string]bool)
+	for _, link := range g.Links() {
+		if link.Source != policyKey {
+			continue
+		}
+		if link.Target != runningKey {
+			t.Errorf("unexpected %s link to %s", link.Relationship, link.Target)
+		}
+		linked[link.Relationship] = true
+	}
+	if !linked[relationshipAppliesTo] || !linked[relationshipAllowsIngressFrom] {
+		t.Errorf("expected the running pod to be isolated and allowed, got %v", linked)
+	}
+
+	if restricted := g.Node(runningKey).ResourceInfo["ingress_restricted"]; restricted != true {
+		t.Errorf("running pod ingress_restricted = %v, want true", restricted)
+	}
+	for _, name := range []string{"host", "succeeded", "failed"} {
+		info := g.Node(namespacedKey(podType, "default", name)).ResourceInfo
+		for _, key := range []string{"ingress_restricted", "egress_restricted", "unrestricted"} {
+			if value, ok := info[key]; ok {
+				t.Errorf("pod %s has %s = %v, want it unset", name, key, value)
+			}
+		}
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// recordUID remembers which node a listed object was rendered as, so owner
+// references can be resolved to nodes regardless of the owner's kind
+func (g *GraphBuilder) recordUID(obj interface{}, id string) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil || accessor.GetUID() == "" {
+		return
+	}
+	g.uids[accessor.GetUID()] = id
+}
+
+// linkOwners links a listed object to each of its owners. Owners that were
+// not collected are represented by an external owner placeholder node.
+func (g *GraphBuilder) linkOwners(obj interface{}) {
+	accessor, err := meta.Accessor(obj)
+	if err != nil {
+		return
+	}
+	id, exists := g.uids[accessor.GetUID()]
+	if !exists {
+		return
+	}
+
+	// Pods are instances of their controller, everything else is managed
+	relationship := relationshipManages
+	if node := g.Node(id); node != nil && node.Type == podType {
+		relationship = relationshipInstanceOf
+	}
+
+	for _, owner := range accessor.GetOwnerReferences() {
+		ownerKey, exists := g.uids[owner.UID]
+		if !exists {
+			ownerKey = g.addExternalOwner(owner)
+		}
+		g.AddLink(ownerKey, id, relationship)
+	}
+}
+
+// addExternalOwner adds a placeholder node for an owner that was not
+// collected and returns its id. Several objects may share the placeholder.
+func (g *GraphBuilder) addExternalOwner(owner metav1.OwnerReference) string {
+	key := clusterKey(externalOwnerType, string(owner.UID))
+	if g.HasNode(key) {
+		return key
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["kind"] = owner.Kind
+	resourceInfo["api_version"] = owner.APIVersion
+	resourceInfo["uid"] = string(owner.UID)
+	resourceInfo["description"] = fmt.Sprintf("%s %s is not collected", owner.Kind, owner.Name)
+
+	g.AddNode(&kutype.Node{
+		Id:           key,
+		Name:         owner.Name,
+		Type:         externalOwnerType,
+		Status:       owner.Kind,
+		Labels:       make(map[string]string),
+		Annotations:  make(map[string]string),
+		ResourceInfo: resourceInfo,
+	})
+	g.uids[owner.UID] = key
+	return key
+}
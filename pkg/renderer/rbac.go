@@ -0,0 +1,292 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	RegisterCollector(roleCollector{})
+	RegisterCollector(clusterRoleCollector{})
+	RegisterCollector(roleBindingCollector{})
+	RegisterCollector(clusterRoleBindingCollector{})
+}
+
+// escalationVerbs let a subject gain permissions beyond the ones it was granted
+var escalationVerbs = map[string]bool{
+	"*":           true,
+	"escalate":    true,
+	"bind":        true,
+	"impersonate": true,
+}
+
+type roleCollector struct{}
+
+func (roleCollector) Name() string { return "roles" }
+
+func (roleCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Rbac().V1().Roles().Informer(), nil
+}
+
+func (roleCollector) BuildNode(obj interface{}) *kutype.Node {
+	r, ok := obj.(*rbacv1.Role)
+	if !ok {
+		return nil
+	}
+	roleKey := namespacedKey(roleType, r.Namespace, r.Name)
+
+	return &kutype.Node{
+		Id:           roleKey,
+		Name:         r.Name,
+		Type:         roleType,
+		Namespace:    r.Namespace,
+		CreationTime: r.CreationTimestamp.Format(time.RFC3339),
+		Labels:       r.Labels,
+		Annotations:  r.Annotations,
+		ResourceInfo: summarizeRules(r.Rules),
+	}
+}
+
+func (roleCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type clusterRoleCollector struct{}
+
+func (clusterRoleCollector) Name() string { return "clusterroles" }
+
+func (clusterRoleCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Rbac().V1().ClusterRoles().Informer(), nil
+}
+
+func (clusterRoleCollector) BuildNode(obj interface{}) *kutype.Node {
+	cr, ok := obj.(*rbacv1.ClusterRole)
+	if !ok {
+		return nil
+	}
+	clusterRoleKey := clusterKey(clusterRoleType, cr.Name)
+
+	resourceInfo := summarizeRules(cr.Rules)
+	resourceInfo["aggregated"] = cr.AggregationRule != nil
+
+	return &kutype.Node{
+		Id:           clusterRoleKey,
+		Name:         cr.Name,
+		Type:         clusterRoleType,
+		Namespace:    "", // ClusterRoles are cluster-scoped
+		CreationTime: cr.CreationTimestamp.Format(time.RFC3339),
+		Labels:       cr.Labels,
+		Annotations:  cr.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (clusterRoleCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type roleBindingCollector struct{}
+
+func (roleBindingCollector) Name() string { return "rolebindings" }
+
+func (roleBindingCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Rbac().V1().RoleBindings().Informer(), nil
+}
+
+func (roleBindingCollector) BuildNode(obj interface{}) *kutype.Node {
+	rb, ok := obj.(*rbacv1.RoleBinding)
+	if !ok {
+		return nil
+	}
+	rbKey := namespacedKey(roleBindingType, rb.Namespace, rb.Name)
+
+	return &kutype.Node{
+		Id:           rbKey,
+		Name:         rb.Name,
+		Type:         roleBindingType,
+		Namespace:    rb.Namespace,
+		CreationTime: rb.CreationTimestamp.Format(time.RFC3339),
+		Labels:       rb.Labels,
+		Annotations:  rb.Annotations,
+		ResourceInfo: summarizeBinding(rb.RoleRef, rb.Subjects),
+	}
+}
+
+func (roleBindingCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	rb, ok := obj.(*rbacv1.RoleBinding)
+	if !ok {
+		return
+	}
+	rbKey := namespacedKey(roleBindingType, rb.Namespace, rb.Name)
+
+	// Link role bindings to their role, which may also be a cluster role
+	if rb.RoleRef.Kind == "ClusterRole" {
+		g.LinkIfExists(rbKey, clusterKey(clusterRoleType, rb.RoleRef.Name), relationshipGrants)
+	} else {
+		g.LinkIfExists(rbKey, namespacedKey(roleType, rb.Namespace, rb.RoleRef.Name), relationshipGrants)
+	}
+
+	linkSubjects(g, rbKey, rb.Namespace, rb.Subjects)
+}
+
+type clusterRoleBindingCollector struct{}
+
+func (clusterRoleBindingCollector) Name() string { return "clusterrolebindings" }
+
+func (clusterRoleBindingCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Rbac().V1().ClusterRoleBindings().Informer(), nil
+}
+
+func (clusterRoleBindingCollector) BuildNode(obj interface{}) *kutype.Node {
+	crb, ok := obj.(*rbacv1.ClusterRoleBinding)
+	if !ok {
+		return nil
+	}
+	crbKey := clusterKey(clusterRoleBindingType, crb.Name)
+
+	return &kutype.Node{
+		Id:           crbKey,
+		Name:         crb.Name,
+		Type:         clusterRoleBindingType,
+		Namespace:    "", // ClusterRoleBindings are cluster-scoped
+		CreationTime: crb.CreationTimestamp.Format(time.RFC3339),
+		Labels:       crb.Labels,
+		Annotations:  crb.Annotations,
+		ResourceInfo: summarizeBinding(crb.RoleRef, crb.Subjects),
+	}
+}
+
+func (clusterRoleBindingCollector) BuildLinks(obj interface{}, g *GraphBuilder) {
+	crb, ok := obj.(*rbacv1.ClusterRoleBinding)
+	if !ok {
+		return
+	}
+	crbKey := clusterKey(clusterRoleBindingType, crb.Name)
+
+	g.LinkIfExists(crbKey, clusterKey(clusterRoleType, crb.RoleRef.Name), relationshipGrants)
+	linkSubjects(g, crbKey, "", crb.Subjects)
+}
+
+// summarizeRules returns the resource info of a role. Each rule is rendered
+// as a single line, e.g. "get,list on apps/deployments".
+func summarizeRules(rules []rbacv1.PolicyRule) map[string]interface{} {
+	summary := make([]string, 0, len(rules))
+	wildcard := false
+	escalation := false
+	for _, rule := range rules {
+		for _, verb := range rule.Verbs {
+			if escalationVerbs[verb] {
+				escalation = true
+			}
+		}
+		for _, values := range [][]string{rule.Verbs, rule.APIGroups, rule.Resources, rule.NonResourceURLs} {
+			for _, value := range values {
+				if value == "*" || strings.HasSuffix(value, "/*") {
+					wildcard = true
+				}
+			}
+		}
+
+		targets := make([]string, 0, len(rule.Resources)+len(rule.NonResourceURLs))
+		for _, resource := range rule.Resources {
+			for _, group := range rule.APIGroups {
+				if group == "" {
+					targets = append(targets, resource)
+				} else {
+					targets = append(targets, group+"/"+resource)
+				}
+			}
+		}
+		targets = append(targets, rule.NonResourceURLs...)
+		line := fmt.Sprintf("%s on %s", strings.Join(rule.Verbs, ","), strings.Join(targets, ","))
+		if len(rule.ResourceNames) > 0 {
+			line += fmt.Sprintf(" (%s)", strings.Join(rule.ResourceNames, ","))
+		}
+		summary = append(summary, line)
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["rules"] = len(rules)
+	resourceInfo["rule_summary"] = summary
+	resourceInfo["wildcard"] = wildcard
+	resourceInfo["escalation"] = escalation
+	return resourceInfo
+}
+
+// summarizeBinding returns the resource info of a role or cluster role binding
+func summarizeBinding(roleRef rbacv1.RoleRef, subjects []rbacv1.Subject) map[string]interface{} {
+	subjectNames := make([]string, 0, len(subjects))
+	for _, subject := range subjects {
+		subjectNames = append(subjectNames, fmt.Sprintf("%s/%s", subject.Kind, subject.Name))
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["role_ref"] = fmt.Sprintf("%s/%s", roleRef.Kind, roleRef.Name)
+	resourceInfo["subjects"] = subjectNames
+	return resourceInfo
+}
+
+// linkSubjects links a binding to its subjects. Users and groups only exist
+// as names in bindings, so nodes are synthesized for them.
+func linkSubjects(g *GraphBuilder, bindingKey, namespace string, subjects []rbacv1.Subject) {
+	for _, subject := range subjects {
+		switch subject.Kind {
+		case rbacv1.ServiceAccountKind:
+			saNamespace := subject.Namespace
+			if saNamespace == "" {
+				saNamespace = namespace
+			}
+			// Cluster role bindings have no namespace to default to, such a
+			// subject names no service account
+			if saNamespace == "" {
+				if binding := g.Node(bindingKey); binding != nil {
+					invalid, _ := binding.ResourceInfo["invalid_subjects"].([]string)
+					binding.ResourceInfo["invalid_subjects"] = append(invalid, subject.Kind+"/"+subject.Name)
+				}
+				continue
+			}
+			g.LinkIfExists(bindingKey, namespacedKey(serviceAccountType, saNamespace, subject.Name), relationshipBindsTo)
+		case rbacv1.UserKind:
+			g.AddLink(bindingKey, addSubject(g, userType, subject.Name), relationshipBindsTo)
+		case rbacv1.GroupKind:
+			g.AddLink(bindingKey, addSubject(g, groupType, subject.Name), relationshipBindsTo)
+		}
+	}
+}
+
+// addSubject adds a user or group node unless it exists and returns its id
+func addSubject(g *GraphBuilder, subjectType, name string) string {
+	key := clusterKey(subjectType, name)
+	if g.HasNode(key) {
+		return key
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["description"] = fmt.Sprintf("RBAC %s: %s", subjectType, name)
+
+	g.AddNode(&kutype.Node{
+		Id:           key,
+		Name:         name,
+		Type:         subjectType,
+		Namespace:    "", // Users and groups are cluster-wide
+		Labels:       make(map[string]string),
+		Annotations:  make(map[string]string),
+		ResourceInfo: resourceInfo,
+	})
+	return key
+}
@@ -0,0 +1,57 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestClusterRoleBindingSkipsServiceAccountsWithoutNamespace(t *testing.T) {
+	crb := &rbacv1.ClusterRoleBinding{
+		ObjectMeta: metav1.ObjectMeta{Name: "readers"},
+		RoleRef:    rbacv1.RoleRef{Kind: "ClusterRole", Name: "view"},
+		Subjects: []rbacv1.Subject{
+			{Kind: rbacv1.ServiceAccountKind, Name: "reader", Namespace: "default"},
+			{Kind: rbacv1.ServiceAccountKind, Name: "orphan"},
+		},
+	}
+
+	g := newGraphBuilder()
+	g.AddNode(clusterRoleBindingCollector{}.BuildNode(crb))
+	for _, name := range []string{"reader", "orphan"} {
+		sa := &corev1.ServiceAccount{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		g.AddNode(serviceAccountCollector{}.BuildNode(sa))
+	}
+	clusterRoleBindingCollector{}.BuildLinks(crb, g)
+
+	crbKey := clusterKey(clusterRoleBindingType, "readers")
+	linked := make([]string, 0)
+	for _, link := range g.Links() {
+		if link.Source == crbKey {
+			linked = append(linked, link.Target)
+		}
+	}
+	if want := []string{namespacedKey(serviceAccountType, "default", "reader")}; !reflect.DeepEqual(linked, want) {
+		t.Errorf("binding links to %v, want %v", linked, want)
+	}
+	if invalid := g.Node(crbKey).ResourceInfo["invalid_subjects"]; !reflect.DeepEqual(invalid, []string{"ServiceAccount/orphan"}) {
+		t.Errorf("invalid_subjects = %v, want [ServiceAccount/orphan]", invalid)
+	}
+}
@@ -0,0 +1,181 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// Ways a pod consumes a config map or secret, reported on its depends_on link
+const (
+	consumptionEnv        = "env"
+	consumptionVolume     = "volume"
+	consumptionPullSecret = "pull-secret"
+)
+
+// configReference is a config map or secret referenced by a pod
+type configReference struct {
+	nodeType    string
+	name        string
+	consumption string
+	// keys lists the consumed keys, nil if the pod consumes all of them
+	keys []string
+}
+
+// podConfigReferences returns the config maps and secrets a pod references
+// from the environment of any of its containers, its volumes and its image
+// pull secrets
+func podConfigReferences(spec *corev1.PodSpec) []configReference {
+	refs := make([]configReference, 0)
+	addEnv := func(env []corev1.EnvVar, envFrom []corev1.EnvFromSource) {
+		for _, e := range env {
+			if e.ValueFrom == nil {
+				continue
+			}
+			if ref := e.ValueFrom.ConfigMapKeyRef; ref != nil {
+				refs = append(refs, configReference{nodeType: configMapType, name: ref.Name, consumption: consumptionEnv, keys: []string{ref.Key}})
+			}
+			if ref := e.ValueFrom.SecretKeyRef; ref != nil {
+				refs = append(refs, configReference{nodeType: secretType, name: ref.Name, consumption: consumptionEnv, keys: []string{ref.Key}})
+			}
+		}
+		for _, e := range envFrom {
+			if ref := e.ConfigMapRef; ref != nil {
+				refs = append(refs, configReference{nodeType: configMapType, name: ref.Name, consumption: consumptionEnv})
+			}
+			if ref := e.SecretRef; ref != nil {
+				refs = append(refs, configReference{nodeType: secretType, name: ref.Name, consumption: consumptionEnv})
+			}
+		}
+	}
+	for _, c := range spec.InitContainers {
+		addEnv(c.Env, c.EnvFrom)
+	}
+	for _, c := range spec.Containers {
+		addEnv(c.Env, c.EnvFrom)
+	}
+	for _, c := range spec.EphemeralContainers {
+		addEnv(c.Env, c.EnvFrom)
+	}
+
+	for _, volume := range spec.Volumes {
+		if volume.ConfigMap != nil {
+			refs = append(refs, configReference{nodeType: configMapType, name: volume.ConfigMap.Name, consumption: consumptionVolume, keys: itemKeys(volume.ConfigMap.Items)})
+		}
+		if volume.Secret != nil {
+			refs = append(refs, configReference{nodeType: secretType, name: volume.Secret.SecretName, consumption: consumptionVolume, keys: itemKeys(volume.Secret.Items)})
+		}
+		if volume.Projected != nil {
+			for _, source := range volume.Projected.Sources {
+				if source.ConfigMap != nil {
+					refs = append(refs, configReference{nodeType: configMapType, name: source.ConfigMap.Name, consumption: consumptionVolume, keys: itemKeys(source.ConfigMap.Items)})
+				}
+				if source.Secret != nil {
+					refs = append(refs, configReference{nodeType: secretType, name: source.Secret.Name, consumption: consumptionVolume, keys: itemKeys(source.Secret.Items)})
+				}
+			}
+		}
+	}
+
+	for _, secret := range spec.ImagePullSecrets {
+		refs = append(refs, configReference{nodeType: secretType, name: secret.Name, consumption: consumptionPullSecret})
+	}
+	return refs
+}
+
+// itemKeys returns the keys a volume projects, nil if it projects all keys
+func itemKeys(items []corev1.KeyToPath) []string {
+	if len(items) == 0 {
+		return nil
+	}
+	keys := make([]string, 0, len(items))
+	for _, item := range items {
+		keys = append(keys, item.Key)
+	}
+	return keys
+}
+
+// linkConfigReferences links the config maps and secrets a pod references to
+// it, one link per object listing every way the pod consumes it and the keys
+// it reads
+func linkConfigReferences(g *GraphBuilder, podKey, namespace string, refs []configReference) {
+	consumptions := make(map[string]map[string]bool)
+	consumedKeys := make(map[string]map[string]bool)
+	objectKeys := make([]string, 0)
+	for _, ref := range refs {
+		key := namespacedKey(ref.nodeType, namespace, ref.name)
+		if _, exists := consumptions[key]; !exists {
+			consumptions[key] = make(map[string]bool)
+			consumedKeys[key] = make(map[string]bool)
+			objectKeys = append(objectKeys, key)
+		}
+		consumptions[key][ref.consumption] = true
+
+		keys := ref.keys
+		if keys == nil {
+			// The pod reads every key the object has
+			if node := g.Node(key); node != nil {
+				keys, _ = node.ResourceInfo["key_names"].([]string)
+			}
+		}
+		for _, k := range keys {
+			consumedKeys[key][k] = true
+		}
+	}
+
+	for _, key := range objectKeys {
+		g.LinkConsumerIfExists(key, podKey, sortedSet(consumptions[key]), sortedSet(consumedKeys[key]))
+	}
+}
+
+// markUnusedKeys lists the keys no pod consumes on every config map or
+// secret node of nodeType, once all depends_on links are in the graph
+func markUnusedKeys(g *GraphBuilder, nodeType string) {
+	used := make(map[string]map[string]bool)
+	for _, link := range g.Links() {
+		if link.Relationship != relationshipDependsOn {
+			continue
+		}
+		for _, k := range link.Keys {
+			if used[link.Source] == nil {
+				used[link.Source] = make(map[string]bool)
+			}
+			used[link.Source][k] = true
+		}
+	}
+
+	for _, node := range g.NodesOfType(nodeType) {
+		keyNames, _ := node.ResourceInfo["key_names"].([]string)
+		unused := make([]string, 0)
+		for _, k := range keyNames {
+			if !used[node.Id][k] {
+				unused = append(unused, k)
+			}
+		}
+		node.ResourceInfo["unused_keys"] = unused
+	}
+}
+
+// sortedSet returns the members of set in order
+func sortedSet(set map[string]bool) []string {
+	members := make([]string, 0, len(set))
+	for member := range set {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
@@ -0,0 +1,179 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// addPodResources adds the effective CPU and memory requests and limits of a
+// pod to its resource info, both summed and per container
+func addPodResources(spec *corev1.PodSpec, resourceInfo map[string]interface{}) {
+	requests, limits := effectivePodResources(spec)
+	cpuRequests := requests[corev1.ResourceCPU]
+	memoryRequests := requests[corev1.ResourceMemory]
+	cpuLimits := limits[corev1.ResourceCPU]
+	memoryLimits := limits[corev1.ResourceMemory]
+
+	resourceInfo["cpu_requests"] = cpuRequests.String()
+	resourceInfo["memory_requests"] = memoryRequests.String()
+	resourceInfo["cpu_limits"] = cpuLimits.String()
+	resourceInfo["memory_limits"] = memoryLimits.String()
+
+	// Raw values let nodes sum up the pods scheduled on them
+	resourceInfo["cpu_requests_millicores"] = cpuRequests.MilliValue()
+	resourceInfo["memory_requests_bytes"] = memoryRequests.Value()
+	resourceInfo["cpu_limits_millicores"] = cpuLimits.MilliValue()
+	resourceInfo["memory_limits_bytes"] = memoryLimits.Value()
+
+	containerResources := make([]map[string]interface{}, 0, len(spec.InitContainers)+len(spec.Containers))
+	for _, c := range spec.InitContainers {
+		containerType := "init"
+		if isSidecar(c) {
+			containerType = "sidecar"
+		}
+		containerResources = append(containerResources, formatContainerResources(c, containerType))
+	}
+	for _, c := range spec.Containers {
+		containerResources = append(containerResources, formatContainerResources(c, "container"))
+	}
+	resourceInfo["container_resources"] = containerResources
+}
+
+// formatContainerResources returns the requests and limits of a single container
+func formatContainerResources(c corev1.Container, containerType string) map[string]interface{} {
+	cpuRequests := c.Resources.Requests[corev1.ResourceCPU]
+	memoryRequests := c.Resources.Requests[corev1.ResourceMemory]
+	cpuLimits := c.Resources.Limits[corev1.ResourceCPU]
+	memoryLimits := c.Resources.Limits[corev1.ResourceMemory]
+
+	return map[string]interface{}{
+		"name":            c.Name,
+		"type":            containerType,
+		"cpu_requests":    cpuRequests.String(),
+		"memory_requests": memoryRequests.String(),
+		"cpu_limits":      cpuLimits.String(),
+		"memory_limits":   memoryLimits.String(),
+	}
+}
+
+// effectivePodResources returns the requests and limits of a pod the way the
+// scheduler accounts for them. Init containers run one after another before
+// the app containers, so only the largest one counts, while native sidecars
+// keep running next to every container started after them.
+func effectivePodResources(spec *corev1.PodSpec) (corev1.ResourceList, corev1.ResourceList) {
+	requests := corev1.ResourceList{}
+	limits := corev1.ResourceList{}
+	for _, c := range spec.Containers {
+		addResources(requests, c.Resources.Requests)
+		addResources(limits, c.Resources.Limits)
+	}
+
+	sidecarRequests := corev1.ResourceList{}
+	sidecarLimits := corev1.ResourceList{}
+	initRequests := corev1.ResourceList{}
+	initLimits := corev1.ResourceList{}
+	for _, c := range spec.InitContainers {
+		if isSidecar(c) {
+			addResources(sidecarRequests, c.Resources.Requests)
+			addResources(sidecarLimits, c.Resources.Limits)
+			maxResources(initRequests, sidecarRequests)
+			maxResources(initLimits, sidecarLimits)
+			continue
+		}
+
+		// A regular init container runs next to the sidecars started before it
+		stepRequests := sidecarRequests.DeepCopy()
+		addResources(stepRequests, c.Resources.Requests)
+		maxResources(initRequests, stepRequests)
+		stepLimits := sidecarLimits.DeepCopy()
+		addResources(stepLimits, c.Resources.Limits)
+		maxResources(initLimits, stepLimits)
+	}
+
+	addResources(requests, sidecarRequests)
+	addResources(limits, sidecarLimits)
+	maxResources(requests, initRequests)
+	maxResources(limits, initLimits)
+
+	// Runtime overhead, e.g. of sandboxed runtime classes
+	addResources(requests, spec.Overhead)
+	if len(limits) > 0 {
+		addResources(limits, spec.Overhead)
+	}
+	return requests, limits
+}
+
+// isSidecar reports whether an init container is a native sidecar
+func isSidecar(c corev1.Container) bool {
+	return c.RestartPolicy != nil && *c.RestartPolicy == corev1.ContainerRestartPolicyAlways
+}
+
+// addResources adds the quantities of src to dst
+func addResources(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		if current, exists := dst[name]; exists {
+			current.Add(quantity)
+			dst[name] = current
+		} else {
+			dst[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// maxResources raises the quantities of dst to those of src where src is larger
+func maxResources(dst, src corev1.ResourceList) {
+	for name, quantity := range src {
+		if current, exists := dst[name]; !exists || quantity.Cmp(current) > 0 {
+			dst[name] = quantity.DeepCopy()
+		}
+	}
+}
+
+// nodeAllocation sums up the requests and limits of the pods on a node
+type nodeAllocation struct {
+	cpuRequests    int64
+	memoryRequests int64
+	cpuLimits      int64
+	memoryLimits   int64
+}
+
+// addNodeAllocation adds the summed requests and limits of the pods on a node
+// to its resource info and compares them against what the node can allocate
+func addNodeAllocation(resourceInfo map[string]interface{}, allocation nodeAllocation) {
+	resourceInfo["cpu_requests"] = resource.NewMilliQuantity(allocation.cpuRequests, resource.DecimalSI).String()
+	resourceInfo["memory_requests"] = resource.NewQuantity(allocation.memoryRequests, resource.BinarySI).String()
+	resourceInfo["cpu_limits"] = resource.NewMilliQuantity(allocation.cpuLimits, resource.DecimalSI).String()
+	resourceInfo["memory_limits"] = resource.NewQuantity(allocation.memoryLimits, resource.BinarySI).String()
+
+	cpuAllocatable, _ := resourceInfo["cpu_allocatable_millicores"].(int64)
+	memoryAllocatable, _ := resourceInfo["memory_allocatable_bytes"].(int64)
+	resourceInfo["cpu_requests_percent"] = percentOf(allocation.cpuRequests, cpuAllocatable)
+	resourceInfo["memory_requests_percent"] = percentOf(allocation.memoryRequests, memoryAllocatable)
+	resourceInfo["cpu_limits_percent"] = percentOf(allocation.cpuLimits, cpuAllocatable)
+	resourceInfo["memory_limits_percent"] = percentOf(allocation.memoryLimits, memoryAllocatable)
+
+	// Limits above allocatable can't all be met at once
+	resourceInfo["overcommitted"] = allocation.cpuLimits > cpuAllocatable || allocation.memoryLimits > memoryAllocatable
+}
+
+// percentOf returns value as a whole percentage of total, 0 if total is unknown
+func percentOf(value, total int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	return value * 100 / total
+}
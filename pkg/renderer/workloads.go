@@ -0,0 +1,327 @@
+// Copyright © 2018 Andreas Fritzler
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"time"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func init() {
+	RegisterCollector(deploymentCollector{})
+	RegisterCollector(replicaSetCollector{})
+	RegisterCollector(daemonSetCollector{})
+	RegisterCollector(statefulSetCollector{})
+	RegisterCollector(jobCollector{})
+	RegisterCollector(cronJobCollector{})
+}
+
+type deploymentCollector struct{}
+
+func (deploymentCollector) Name() string { return "deployments" }
+
+func (deploymentCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Apps().V1().Deployments().Informer(), nil
+}
+
+func (deploymentCollector) BuildNode(obj interface{}) *kutype.Node {
+	d, ok := obj.(*appsv1.Deployment)
+	if !ok {
+		return nil
+	}
+	deploymentKey := namespacedKey(deploymentType, d.Namespace, d.Name)
+	status := fmt.Sprintf("%d/%d", d.Status.ReadyReplicas, d.Status.Replicas)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["replicas"] = d.Status.Replicas
+	resourceInfo["ready_replicas"] = d.Status.ReadyReplicas
+	resourceInfo["available_replicas"] = d.Status.AvailableReplicas
+	resourceInfo["unavailable_replicas"] = d.Status.UnavailableReplicas
+	resourceInfo["updated_replicas"] = d.Status.UpdatedReplicas
+	resourceInfo["strategy_type"] = string(d.Spec.Strategy.Type)
+
+	if d.Spec.Replicas != nil {
+		resourceInfo["desired_replicas"] = *d.Spec.Replicas
+	}
+
+	// Deployment conditions
+	conditions := make([]string, 0)
+	for _, condition := range d.Status.Conditions {
+		if condition.Status == "True" {
+			conditions = append(conditions, string(condition.Type))
+		}
+	}
+	resourceInfo["conditions"] = conditions
+
+	return &kutype.Node{
+		Id:           deploymentKey,
+		Name:         d.Name,
+		Type:         deploymentType,
+		Namespace:    d.Namespace,
+		Status:       status,
+		CreationTime: d.CreationTimestamp.Format(time.RFC3339),
+		Labels:       d.Labels,
+		Annotations:  d.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (deploymentCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type replicaSetCollector struct{}
+
+func (replicaSetCollector) Name() string { return "replicasets" }
+
+func (replicaSetCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Apps().V1().ReplicaSets().Informer(), nil
+}
+
+func (replicaSetCollector) BuildNode(obj interface{}) *kutype.Node {
+	rs, ok := obj.(*appsv1.ReplicaSet)
+	if !ok {
+		return nil
+	}
+	rsKey := namespacedKey(replicaSetType, rs.Namespace, rs.Name)
+	status := fmt.Sprintf("%d/%d", rs.Status.ReadyReplicas, rs.Status.Replicas)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["replicas"] = rs.Status.Replicas
+	resourceInfo["ready_replicas"] = rs.Status.ReadyReplicas
+	resourceInfo["available_replicas"] = rs.Status.AvailableReplicas
+	resourceInfo["fully_labeled_replicas"] = rs.Status.FullyLabeledReplicas
+	if rs.Spec.Replicas != nil {
+		resourceInfo["desired_replicas"] = *rs.Spec.Replicas
+	}
+
+	return &kutype.Node{
+		Id:           rsKey,
+		Name:         rs.Name,
+		Type:         replicaSetType,
+		Namespace:    rs.Namespace,
+		Status:       status,
+		CreationTime: rs.CreationTimestamp.Format(time.RFC3339),
+		Labels:       rs.Labels,
+		Annotations:  rs.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (replicaSetCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type daemonSetCollector struct{}
+
+func (daemonSetCollector) Name() string { return "daemonsets" }
+
+func (daemonSetCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Apps().V1().DaemonSets().Informer(), nil
+}
+
+func (daemonSetCollector) BuildNode(obj interface{}) *kutype.Node {
+	ds, ok := obj.(*appsv1.DaemonSet)
+	if !ok {
+		return nil
+	}
+	dsKey := namespacedKey(daemonSetType, ds.Namespace, ds.Name)
+	status := fmt.Sprintf("%d/%d", ds.Status.NumberReady, ds.Status.DesiredNumberScheduled)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["desired_number_scheduled"] = ds.Status.DesiredNumberScheduled
+	resourceInfo["current_number_scheduled"] = ds.Status.CurrentNumberScheduled
+	resourceInfo["number_ready"] = ds.Status.NumberReady
+	resourceInfo["number_available"] = ds.Status.NumberAvailable
+	resourceInfo["number_unavailable"] = ds.Status.NumberUnavailable
+	resourceInfo["number_misscheduled"] = ds.Status.NumberMisscheduled
+	resourceInfo["update_strategy"] = string(ds.Spec.UpdateStrategy.Type)
+
+	return &kutype.Node{
+		Id:           dsKey,
+		Name:         ds.Name,
+		Type:         daemonSetType,
+		Namespace:    ds.Namespace,
+		Status:       status,
+		CreationTime: ds.CreationTimestamp.Format(time.RFC3339),
+		Labels:       ds.Labels,
+		Annotations:  ds.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (daemonSetCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type statefulSetCollector struct{}
+
+func (statefulSetCollector) Name() string { return "statefulsets" }
+
+func (statefulSetCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Apps().V1().StatefulSets().Informer(), nil
+}
+
+func (statefulSetCollector) BuildNode(obj interface{}) *kutype.Node {
+	ss, ok := obj.(*appsv1.StatefulSet)
+	if !ok {
+		return nil
+	}
+	ssKey := namespacedKey(statefulSetType, ss.Namespace, ss.Name)
+	status := fmt.Sprintf("%d/%d", ss.Status.ReadyReplicas, ss.Status.Replicas)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["replicas"] = ss.Status.Replicas
+	resourceInfo["ready_replicas"] = ss.Status.ReadyReplicas
+	resourceInfo["current_replicas"] = ss.Status.CurrentReplicas
+	resourceInfo["updated_replicas"] = ss.Status.UpdatedReplicas
+	resourceInfo["current_revision"] = ss.Status.CurrentRevision
+	resourceInfo["update_revision"] = ss.Status.UpdateRevision
+	resourceInfo["update_strategy"] = string(ss.Spec.UpdateStrategy.Type)
+	if ss.Spec.Replicas != nil {
+		resourceInfo["desired_replicas"] = *ss.Spec.Replicas
+	}
+
+	return &kutype.Node{
+		Id:           ssKey,
+		Name:         ss.Name,
+		Type:         statefulSetType,
+		Namespace:    ss.Namespace,
+		Status:       status,
+		CreationTime: ss.CreationTimestamp.Format(time.RFC3339),
+		Labels:       ss.Labels,
+		Annotations:  ss.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (statefulSetCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type jobCollector struct{}
+
+func (jobCollector) Name() string { return "jobs" }
+
+func (jobCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Batch().V1().Jobs().Informer(), nil
+}
+
+func (jobCollector) BuildNode(obj interface{}) *kutype.Node {
+	j, ok := obj.(*batchv1.Job)
+	if !ok {
+		return nil
+	}
+	jobKey := namespacedKey(jobType, j.Namespace, j.Name)
+
+	// Jobs without completions finish after their first successful pod
+	completions := int32(1)
+	if j.Spec.Completions != nil {
+		completions = *j.Spec.Completions
+	}
+	status := fmt.Sprintf("%d/%d", j.Status.Succeeded, completions)
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["completions"] = completions
+	resourceInfo["active"] = j.Status.Active
+	resourceInfo["succeeded"] = j.Status.Succeeded
+	resourceInfo["failed"] = j.Status.Failed
+	if j.Spec.Parallelism != nil {
+		resourceInfo["parallelism"] = *j.Spec.Parallelism
+	}
+	if j.Spec.BackoffLimit != nil {
+		resourceInfo["backoff_limit"] = *j.Spec.BackoffLimit
+	}
+	if j.Spec.Suspend != nil {
+		resourceInfo["suspend"] = *j.Spec.Suspend
+	}
+	if j.Status.StartTime != nil {
+		resourceInfo["start_time"] = j.Status.StartTime.Format(time.RFC3339)
+	}
+	if j.Status.CompletionTime != nil {
+		resourceInfo["completion_time"] = j.Status.CompletionTime.Format(time.RFC3339)
+	}
+
+	// Job conditions
+	conditions := make([]string, 0)
+	for _, condition := range j.Status.Conditions {
+		if condition.Status == "True" {
+			conditions = append(conditions, string(condition.Type))
+		}
+	}
+	resourceInfo["conditions"] = conditions
+
+	return &kutype.Node{
+		Id:           jobKey,
+		Name:         j.Name,
+		Type:         jobType,
+		Namespace:    j.Namespace,
+		Status:       status,
+		CreationTime: j.CreationTimestamp.Format(time.RFC3339),
+		Labels:       j.Labels,
+		Annotations:  j.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (jobCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
+
+type cronJobCollector struct{}
+
+func (cronJobCollector) Name() string { return "cronjobs" }
+
+func (cronJobCollector) Informer(c *Cache) (cache.SharedIndexInformer, error) {
+	return c.Factory().Batch().V1().CronJobs().Informer(), nil
+}
+
+func (cronJobCollector) BuildNode(obj interface{}) *kutype.Node {
+	cj, ok := obj.(*batchv1.CronJob)
+	if !ok {
+		return nil
+	}
+	cronJobKey := namespacedKey(cronJobType, cj.Namespace, cj.Name)
+
+	suspended := cj.Spec.Suspend != nil && *cj.Spec.Suspend
+	status := "Scheduled"
+	if suspended {
+		status = "Suspended"
+	}
+
+	resourceInfo := make(map[string]interface{})
+	resourceInfo["schedule"] = cj.Spec.Schedule
+	resourceInfo["suspend"] = suspended
+	resourceInfo["concurrency_policy"] = string(cj.Spec.ConcurrencyPolicy)
+	resourceInfo["active"] = len(cj.Status.Active)
+	if cj.Spec.TimeZone != nil {
+		resourceInfo["time_zone"] = *cj.Spec.TimeZone
+	}
+	if cj.Status.LastScheduleTime != nil {
+		resourceInfo["last_schedule_time"] = cj.Status.LastScheduleTime.Format(time.RFC3339)
+	}
+	if cj.Status.LastSuccessfulTime != nil {
+		resourceInfo["last_successful_time"] = cj.Status.LastSuccessfulTime.Format(time.RFC3339)
+	}
+
+	return &kutype.Node{
+		Id:           cronJobKey,
+		Name:         cj.Name,
+		Type:         cronJobType,
+		Namespace:    cj.Namespace,
+		Status:       status,
+		CreationTime: cj.CreationTimestamp.Format(time.RFC3339),
+		Labels:       cj.Labels,
+		Annotations:  cj.Annotations,
+		ResourceInfo: resourceInfo,
+	}
+}
+
+func (cronJobCollector) BuildLinks(obj interface{}, g *GraphBuilder) {}
@@ -27,7 +27,6 @@ type Node struct {
 	Status        string            `json:"status,omitempty"`
 	StatusMessage string            `json:"statusmessage,omitempty"`
 	CreationTime  string            `json:"creationtime,omitempty"`
-	Age           string            `json:"age,omitempty"`
 	Labels        map[string]string `json:"labels,omitempty"`
 	Annotations   map[string]string `json:"annotations,omitempty"`
 	// Resource-specific information
@@ -39,4 +38,8 @@ type Link struct {
 	Target       string `json:"target"`
 	Value        int    `json:"value"`
 	Relationship string `json:"relationship,omitempty"`
+	// Consumption lists how a pod consumes a config map or secret, e.g. env or volume
+	Consumption []string `json:"consumption,omitempty"`
+	// Keys lists the keys of a config map or secret a pod consumes
+	Keys []string `json:"keys,omitempty"`
 }
@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+)
+
+// Updates carry slim nodes, see renderer.SlimNode. Clients ask for the rest
+// of a node when they show its details.
+
+// detailsMessage answers a details message with the full node
+type detailsMessage struct {
+	Type      string       `json:"type"`
+	RequestId string       `json:"request_id,omitempty"`
+	Node      *kutype.Node `json:"node"`
+}
+
+// NodeDetails returns the node with id including its labels, annotations and
+// all of its ResourceInfo. It returns nil if there is no such node or the hub
+// is stopped.
+func (h *Hub) NodeDetails(id string) *kutype.Node {
+	var node *kutype.Node
+	h.do(func() {
+		node = h.lookupNode(id)
+	})
+	return node
+}
+
+// lookupNode returns the node with id from the last graph. It is fetched
+// again if changes were skipped since, see Hub.stale.
+func (h *Hub) lookupNode(id string) *kutype.Node {
+	if h.graph == nil || h.stale {
+		h.fetchGraph()
+	}
+	return h.nodes[id]
+}
+
+// sendDetails answers a client's details message
+func (h *Hub) sendDetails(client *Client, requestId, id string) {
+	if !h.clients[client] {
+		return
+	}
+	node := h.lookupNode(id)
+	if node == nil {
+		h.sendError(client, requestId, fmt.Errorf("node %q not found", id))
+		return
+	}
+
+	message, err := json.Marshal(detailsMessage{Type: messageDetails, RequestId: requestId, Node: node})
+	if err != nil {
+		log.Printf("Failed to marshal node details: %v", err)
+		return
+	}
+	h.deliver(client, message)
+}
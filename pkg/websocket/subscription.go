@@ -0,0 +1,183 @@
+package websocket
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/afritzler/kube-universe/pkg/delta"
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Messages clients send over the websocket
+const (
+	// messageResync asks for a full update after a checksum mismatch
+	messageResync = "resync"
+	// messageSubscribe replaces the client's subscription
+	messageSubscribe = "subscribe"
+	// messageUnsubscribe goes back to receiving the whole graph
+	messageUnsubscribe = "unsubscribe"
+	// messageDetails asks for the full node with an id, it is answered with
+	// a message of the same type
+	messageDetails = "details"
+)
+
+// maxMessageSize limits inbound messages, subscriptions can list many
+// namespaces and types
+const maxMessageSize = 64 * 1024
+
+// clientMessage is a message sent by a client
+type clientMessage struct {
+	Type         string        `json:"type"`
+	Subscription *Subscription `json:"subscription,omitempty"`
+	// Id is the node a details message asks for
+	Id string `json:"id,omitempty"`
+	// RequestId is echoed in the answer to a details message
+	RequestId string `json:"request_id,omitempty"`
+}
+
+// errorMessage tells a client why its message was rejected
+type errorMessage struct {
+	Type      string `json:"type"`
+	RequestId string `json:"request_id,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Subscription limits which part of the graph a client receives. Empty fields
+// don't filter, set fields must all match.
+type Subscription struct {
+	// Namespaces keeps resources in these namespaces and the namespaces
+	// themselves, cluster-scoped resources are dropped
+	Namespaces []string `json:"namespaces,omitempty"`
+	// NodeTypes keeps nodes of these types, e.g. pod or deployment
+	NodeTypes []string `json:"node_types,omitempty"`
+	// Relationships keeps links of these relationships, e.g. manages or depends_on
+	Relationships []string `json:"relationships,omitempty"`
+	// LabelSelector keeps nodes whose labels match, e.g. app=web,tier!=db
+	LabelSelector string `json:"label_selector,omitempty"`
+}
+
+// filter is a parsed subscription
+type filter struct {
+	namespaces    map[string]bool
+	nodeTypes     map[string]bool
+	relationships map[string]bool
+	selector      labels.Selector
+}
+
+func newFilter(s *Subscription) (*filter, error) {
+	f := &filter{
+		namespaces:    toSet(s.Namespaces),
+		nodeTypes:     toSet(s.NodeTypes),
+		relationships: toSet(s.Relationships),
+	}
+	if s.LabelSelector != "" {
+		selector, err := labels.Parse(s.LabelSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid label selector: %s", err)
+		}
+		f.selector = selector
+	}
+	return f, nil
+}
+
+func toSet(values []string) map[string]bool {
+	if len(values) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+func (f *filter) matchesNode(node *kutype.Node) bool {
+	if f.namespaces != nil {
+		if node.Type == "namespace" {
+			if !f.namespaces[node.Name] {
+				return false
+			}
+		} else if !f.namespaces[node.Namespace] {
+			return false
+		}
+	}
+	if f.nodeTypes != nil && !f.nodeTypes[node.Type] {
+		return false
+	}
+	if f.selector != nil && !f.selector.Matches(labels.Set(node.Labels)) {
+		return false
+	}
+	return true
+}
+
+// apply returns the part of the graph the filter keeps. Links are kept if
+// both of their ends are.
+func (f *filter) apply(graph *kutype.Graph) *kutype.Graph {
+	nodes := []kutype.Node{}
+	kept := make(map[string]bool)
+	for i := range *graph.Nodes {
+		node := &(*graph.Nodes)[i]
+		if f.matchesNode(node) {
+			nodes = append(nodes, *node)
+			kept[node.Id] = true
+		}
+	}
+
+	links := []kutype.Link{}
+	for _, link := range *graph.Links {
+		if !kept[link.Source] || !kept[link.Target] {
+			continue
+		}
+		if f.relationships != nil && !f.relationships[link.Relationship] {
+			continue
+		}
+		links = append(links, link)
+	}
+	return &kutype.Graph{Nodes: &nodes, Links: &links}
+}
+
+// view is the filtered graph a subscribed client sees. It has its own delta
+// state, so revisions and checksums refer to the filtered graph.
+type view struct {
+	filter  *filter
+	tracker *delta.DeltaTracker
+}
+
+// handleMessage acts on a message from the client
+func (c *Client) handleMessage(data []byte) error {
+	var message clientMessage
+	if err := json.Unmarshal(data, &message); err != nil {
+		return fmt.Errorf("malformed message: %s", err)
+	}
+
+	switch message.Type {
+	case messageResync:
+		select {
+		case c.hub.resync <- c:
+		case <-c.hub.done:
+		}
+	case messageSubscribe:
+		if message.Subscription == nil {
+			return fmt.Errorf("subscribe message without subscription")
+		}
+		f, err := newFilter(message.Subscription)
+		if err != nil {
+			return err
+		}
+		c.hub.do(func() {
+			c.hub.setView(c, f)
+		})
+	case messageUnsubscribe:
+		c.hub.do(func() {
+			c.hub.setView(c, nil)
+		})
+	case messageDetails:
+		c.hub.do(func() {
+			c.hub.sendDetails(c, message.RequestId, message.Id)
+		})
+	default:
+		return fmt.Errorf("unknown message type %q", message.Type)
+	}
+	return nil
+}
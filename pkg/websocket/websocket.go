@@ -1,9 +1,12 @@
 package websocket
 
 import (
+	"context"
 	"encoding/json"
 	"log"
 	"net/http"
+	"strconv"
+	"sync"
 	"time"
 
 	"github.com/afritzler/kube-universe/pkg/delta"
@@ -12,177 +15,452 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// catchUpInterval is how often the hub checks whether lagging clients
+// emptied their send buffer
+const catchUpInterval = time.Second
+
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow connections from any origin
 	},
 }
 
+// HubConfig controls how the hub turns cluster changes into updates
+type HubConfig struct {
+	// CoalesceWindow is how long the hub collects further changes after the
+	// first one before it builds and pushes a delta
+	CoalesceWindow time.Duration
+	// PollInterval rebuilds the graph periodically even when no change events
+	// arrive, zero disables polling
+	PollInterval time.Duration
+	// IgnoredFields are node fields whose changes alone don't produce a
+	// delta, see delta.NewDeltaTracker
+	IgnoredFields []string
+	// IgnoredFieldsMaxHold is how long changes to ignored fields alone are
+	// held back before they are pushed anyway, zero holds them until another
+	// change is pushed
+	IgnoredFieldsMaxHold time.Duration
+	// HistorySize is how many recent deltas are kept for clients that
+	// reconnect, zero makes every reconnect load the full graph
+	HistorySize int
+}
+
+// graphSource is the part of renderer.Cache the hub uses
+type graphSource interface {
+	BuildGraph() *kutype.Graph
+	Changes() <-chan struct{}
+}
+
+// Hub fans graph updates out to websocket clients. Its state is owned by
+// the goroutine running Run, everything else talks to it through channels.
 type Hub struct {
+	cache  graphSource
+	config HubConfig
+
+	register   chan *Client
+	unregister chan *Client
+	resync     chan *Client
+	// requests run functions on the Run goroutine so they can read its state
+	requests chan func()
+	stop     chan struct{}
+	stopOnce sync.Once
+	// done is closed once Run returned and all clients were closed
+	done chan struct{}
+
+	// Only accessed by the Run goroutine
 	clients      map[*Client]bool
-	broadcast    chan []byte
-	register     chan *Client
-	unregister   chan *Client
-	kubeconfig   string
-	lastData     []byte
 	deltaTracker *delta.DeltaTracker
+	history      *delta.History
+	// stale is set when a fetch was skipped because no client was
+	// connected, the tracked graph may be behind the cluster
+	stale bool
+	// graph is the last graph fetched with all details, new subscriptions
+	// start from it and nodes indexes it by id
+	graph *kutype.Graph
+	nodes map[string]*kutype.Node
+	// catchUp fires while clients are lagging, see deliver
+	catchUp <-chan time.Time
+	// droppedUpdates counts messages lagging clients missed, resyncs the
+	// full updates they got after catching up
+	droppedUpdates int
+	resyncs        int
 }
 
 type Client struct {
 	hub  *Hub
 	conn *websocket.Conn
 	send chan []byte
+	// mode is the delta.Mode* the client negotiated for changed nodes
+	mode string
+	// resume is set for reconnecting clients that already have the graph
+	// at revision of epoch
+	resume   bool
+	epoch    string
+	revision uint64
+	// view is set for clients that subscribed to part of the graph, it is
+	// only accessed by the Run goroutine
+	view *view
+	// lagging is set when the client's send buffer was full, it gets no
+	// further messages until it caught up. Only accessed by the Run goroutine.
+	lagging bool
 }
 
-func NewHub(kubeconfig string) *Hub {
+func NewHub(cache *renderer.Cache, config HubConfig) *Hub {
+	return newHub(cache, config)
+}
+
+func newHub(cache graphSource, config HubConfig) *Hub {
 	return &Hub{
-		clients:      make(map[*Client]bool),
-		broadcast:    make(chan []byte),
+		cache:        cache,
+		config:       config,
 		register:     make(chan *Client),
 		unregister:   make(chan *Client),
-		kubeconfig:   kubeconfig,
-		lastData:     nil,
-		deltaTracker: delta.NewDeltaTracker(),
+		resync:       make(chan *Client),
+		requests:     make(chan func()),
+		stop:         make(chan struct{}),
+		done:         make(chan struct{}),
+		clients:      make(map[*Client]bool),
+		deltaTracker: newTracker(config),
+		history:      delta.NewHistory(config.HistorySize),
 	}
 }
 
+// newTracker creates a delta tracker for the whole graph or a view
+func newTracker(config HubConfig) *delta.DeltaTracker {
+	tracker := delta.NewDeltaTracker(config.IgnoredFields...)
+	tracker.SetMaxHold(config.IgnoredFieldsMaxHold)
+	return tracker
+}
+
+// Run serves clients until Stop is called. It pushes a delta once the
+// coalescing window after a cluster change has passed, and on every poll
+// interval as a fallback.
 func (h *Hub) Run() {
-	ticker := time.NewTicker(3 * time.Second) // Check every 3 seconds for faster updates
-	defer ticker.Stop()
+	defer close(h.done)
 
-	go func() {
-		for range ticker.C {
-			// Only fetch if we have clients
-			if len(h.clients) > 0 {
-				h.fetchAndBroadcast()
-			}
-		}
-	}()
+	var poll <-chan time.Time
+	if h.config.PollInterval > 0 {
+		ticker := time.NewTicker(h.config.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
 
+	var coalesced <-chan time.Time
 	for {
 		select {
+		case <-h.stop:
+			for client := range h.clients {
+				h.removeClient(client)
+			}
+			log.Printf("Websocket hub stopped")
+			return
+
 		case client := <-h.register:
+			// Catch up on changes skipped while nobody was connected before
+			// the client is served the snapshot
+			if h.stale {
+				h.fetchAndBroadcast()
+			}
 			h.clients[client] = true
 			log.Printf("Client connected. Total clients: %d", len(h.clients))
 			// Send initial data to new client
-			go h.sendInitialData(client)
+			h.sendInitialData(client)
 
 		case client := <-h.unregister:
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+			if h.clients[client] {
+				h.removeClient(client)
 				log.Printf("Client disconnected. Total clients: %d", len(h.clients))
 			}
 
-		case message := <-h.broadcast:
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
-				}
+		case client := <-h.resync:
+			// The client found its graph doesn't match the checksum
+			if h.clients[client] {
+				client.resume = false
+				h.sendInitialData(client)
+			}
+
+		case request := <-h.requests:
+			request()
+
+		case <-h.catchUp:
+			h.catchUp = nil
+			h.resyncLagging()
+
+		case <-h.cache.Changes():
+			// Start the window on the first change, later ones ride along
+			if coalesced == nil {
+				coalesced = time.After(h.config.CoalesceWindow)
+			}
+
+		case <-coalesced:
+			coalesced = nil
+			// Only fetch if we have clients
+			if len(h.clients) > 0 {
+				h.fetchAndBroadcast()
+			} else {
+				h.stale = true
+			}
+
+		case <-poll:
+			if len(h.clients) > 0 {
+				h.fetchAndBroadcast()
+			} else {
+				h.stale = true
 			}
 		}
 	}
 }
 
+// Stop disconnects all clients and ends Run. It waits until Run returned or
+// ctx is done, whichever comes first.
+func (h *Hub) Stop(ctx context.Context) error {
+	h.stopOnce.Do(func() {
+		close(h.stop)
+	})
+	select {
+	case <-h.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// do runs f on the Run goroutine and waits for it. It returns false if the
+// hub was stopped and f didn't run.
+func (h *Hub) do(f func()) bool {
+	finished := make(chan struct{})
+	select {
+	case h.requests <- func() {
+		f()
+		close(finished)
+	}:
+	case <-h.done:
+		return false
+	}
+	<-finished
+	return true
+}
+
+// removeClient forgets a client and closes its send channel, which makes its
+// write pump close the connection
+func (h *Hub) removeClient(client *Client) {
+	delete(h.clients, client)
+	close(client.send)
+}
+
+// deliver queues a message for a client. A client whose send buffer is full
+// is marked lagging, it misses all messages until it emptied its buffer and
+// then gets a single full update instead.
+func (h *Hub) deliver(client *Client, message []byte) bool {
+	if client.lagging {
+		h.droppedUpdates++
+		return false
+	}
+	select {
+	case client.send <- message:
+		return true
+	default:
+		log.Printf("Client can't keep up, it is resynced once it caught up")
+		client.lagging = true
+		h.droppedUpdates++
+		if h.catchUp == nil {
+			h.catchUp = time.After(catchUpInterval)
+		}
+		return false
+	}
+}
+
+// resyncLagging sends lagging clients that emptied their send buffer a full
+// update and keeps checking on the others
+func (h *Hub) resyncLagging() {
+	for client := range h.clients {
+		if !client.lagging || len(client.send) > 0 {
+			continue
+		}
+		client.lagging = false
+		client.resume = false
+		h.resyncs++
+		h.sendInitialData(client)
+	}
+
+	for client := range h.clients {
+		if client.lagging && h.catchUp == nil {
+			h.catchUp = time.After(catchUpInterval)
+		}
+	}
+}
+
 func (h *Hub) fetchAndBroadcast() {
-	data, err := renderer.GetGraph(h.kubeconfig)
+	graph := h.fetchGraph()
+	h.stale = false
+
+	// Generate delta and keep it for clients that reconnect
+	deltaUpdate, err := h.deltaTracker.GenerateDelta(renderer.SlimGraph(graph))
 	if err != nil {
-		log.Printf("Failed to fetch graph data: %v", err)
+		log.Printf("Failed to generate delta: %v", err)
 		return
 	}
+	if deltaUpdate != nil {
+		h.history.Add(deltaUpdate)
+		log.Printf("Broadcasting %s update to %d clients", deltaUpdate.Type, len(h.clients))
+	}
 
-	// Parse the graph data
-	var graph kutype.Graph
-	if err := json.Unmarshal(data, &graph); err != nil {
-		log.Printf("Failed to parse graph data: %v", err)
-		return
+	// Encode the update once per mode the connected clients use, subscribed
+	// clients get their own delta
+	messages := make(map[string][]byte)
+	for client := range h.clients {
+		if client.view != nil {
+			h.sendView(client, graph, false)
+			continue
+		}
+		// If no changes, don't broadcast
+		if deltaUpdate == nil {
+			continue
+		}
+		message, encoded := messages[client.mode]
+		if !encoded {
+			if message, err = deltaUpdate.ForMode(client.mode).ToJSON(); err != nil {
+				log.Printf("Failed to marshal delta: %v", err)
+				continue
+			}
+			messages[client.mode] = message
+		}
+		h.deliver(client, message)
 	}
+}
 
-	// Generate delta
-	deltaUpdate, err := h.deltaTracker.GenerateDelta(&graph)
-	if err != nil {
-		log.Printf("Failed to generate delta: %v", err)
+// fetchGraph builds the current graph and keeps it for subscriptions and
+// details requests
+func (h *Hub) fetchGraph() *kutype.Graph {
+	graph := h.cache.BuildGraph()
+	h.graph = graph
+	h.nodes = make(map[string]*kutype.Node, len(*graph.Nodes))
+	for i := range *graph.Nodes {
+		h.nodes[(*graph.Nodes)[i].Id] = &(*graph.Nodes)[i]
+	}
+	return graph
+}
+
+// setView changes which part of the graph a client receives and sends it a
+// full update of it. A nil filter goes back to the whole graph.
+func (h *Hub) setView(client *Client, f *filter) {
+	if !h.clients[client] {
+		return
+	}
+	client.resume = false
+	if f == nil {
+		client.view = nil
+		h.sendInitialData(client)
 		return
 	}
 
-	// If no changes, don't broadcast
-	if deltaUpdate == nil {
+	client.view = &view{
+		filter:  f,
+		tracker: newTracker(h.config),
+	}
+	if h.graph == nil {
+		// Nothing fetched yet, the first fetch sends the view's full update
+		h.fetchAndBroadcast()
 		return
 	}
+	h.sendView(client, h.graph, true)
+}
 
-	// Convert delta to JSON
-	deltaJSON, err := deltaUpdate.ToJSON()
+// sendView sends a subscribed client the changes to its part of graph. The
+// initial update is sent even if the view is empty, so the client drops what
+// it had before.
+func (h *Hub) sendView(client *Client, graph *kutype.Graph, initial bool) {
+	update, err := client.view.tracker.GenerateDelta(renderer.SlimGraph(client.view.filter.apply(graph)))
+	if err != nil {
+		log.Printf("Failed to generate delta for subscription: %v", err)
+		return
+	}
+	if update == nil && initial {
+		update = &delta.DeltaUpdate{
+			Type:  "full",
+			Epoch: client.view.tracker.Epoch(),
+			Nodes: []kutype.Node{},
+			Links: []kutype.Link{},
+		}
+	}
+	if update == nil {
+		return
+	}
+	message, err := update.ForMode(client.mode).ToJSON()
 	if err != nil {
 		log.Printf("Failed to marshal delta: %v", err)
 		return
 	}
-
-	// Broadcast delta
-	log.Printf("Broadcasting %s update to %d clients", deltaUpdate.Type, len(h.clients))
-	h.broadcast <- deltaJSON
-
-	// Update lastData for backward compatibility
-	h.lastData = make([]byte, len(data))
-	copy(h.lastData, data)
+	h.deliver(client, message)
 }
 
-func bytesEqual(a, b []byte) bool {
-	if len(a) != len(b) {
-		return false
+// sendError tells a client its message was rejected, requestId is set for
+// messages that expect an answer
+func (h *Hub) sendError(client *Client, requestId string, reason error) {
+	if !h.clients[client] {
+		return
 	}
-	for i := range a {
-		if a[i] != b[i] {
-			return false
-		}
+	message, err := json.Marshal(errorMessage{Type: "error", RequestId: requestId, Message: reason.Error()})
+	if err != nil {
+		log.Printf("Failed to marshal error: %v", err)
+		return
 	}
-	return true
+	h.deliver(client, message)
 }
 
+// sendInitialData catches a client up. Resuming clients only get the updates
+// they missed, everyone else gets a full update of the current revision.
 func (h *Hub) sendInitialData(client *Client) {
-	data, err := renderer.GetGraph(h.kubeconfig)
-	if err != nil {
-		log.Printf("Failed to fetch initial graph data: %v", err)
+	// Subscribed clients get their view, it is tracked from the moment they
+	// subscribed
+	if client.view != nil {
+		h.sendSnapshot(client, client.view.tracker)
 		return
 	}
 
-	// Parse the graph data
-	var graph kutype.Graph
-	if err := json.Unmarshal(data, &graph); err != nil {
-		log.Printf("Failed to parse initial graph data: %v", err)
-		return
+	if client.resume {
+		if updates, resumed := h.history.Since(client.epoch, client.revision); resumed {
+			for _, update := range updates {
+				message, err := update.ForMode(client.mode).ToJSON()
+				if err != nil {
+					log.Printf("Failed to marshal initial data: %v", err)
+					return
+				}
+				if !h.deliver(client, message) {
+					return
+				}
+			}
+			log.Printf("Resumed client at revision %d with %d missed updates", client.revision, len(updates))
+			return
+		}
 	}
 
-	// For new clients, always send a full update
-	fullUpdate := &delta.DeltaUpdate{
-		Type:  "full",
-		Nodes: *graph.Nodes,
-		Links: *graph.Links,
+	if !h.sendSnapshot(client, h.deltaTracker) {
+		// Nothing tracked yet, the first update is a full one for everyone
+		h.fetchAndBroadcast()
 	}
+}
 
-	// Convert to JSON
-	fullUpdateJSON, err := fullUpdate.ToJSON()
+// sendSnapshot sends a client the full update of the graph tracker tracks.
+// Full updates look the same in every mode, so clients connecting at the same
+// revision share one encoded snapshot instead of each building the graph. The
+// shared tracker is brought up to date when clients register, see Hub.stale.
+// It returns false if nothing has been tracked yet.
+func (h *Hub) sendSnapshot(client *Client, tracker *delta.DeltaTracker) bool {
+	message, err := tracker.SnapshotJSON()
 	if err != nil {
 		log.Printf("Failed to marshal initial data: %v", err)
-		return
+		return true
 	}
-
-	// Store the data as lastData if it's the first client
-	if h.lastData == nil {
-		h.lastData = make([]byte, len(data))
-		copy(h.lastData, data)
+	if message == nil {
+		return false
 	}
-
-	select {
-	case client.send <- fullUpdateJSON:
-		log.Printf("Sent initial full update to new client (%d nodes, %d links)",
-			len(*graph.Nodes), len(*graph.Links))
-	default:
-		close(client.send)
-		delete(h.clients, client)
+	if h.deliver(client, message) {
+		snapshot := tracker.Snapshot()
+		log.Printf("Sent full update at revision %d to client (%d nodes, %d links)",
+			snapshot.Revision, len(snapshot.Nodes), len(snapshot.Links))
 	}
+	return true
 }
 
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
@@ -192,13 +470,37 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Clients opt into node patches with /ws?mode=merge-patch
+	query := r.URL.Query()
+	mode := delta.ModeFull
+	if query.Get("mode") == delta.ModeMergePatch {
+		mode = delta.ModeMergePatch
+	}
+
 	client := &Client{
 		hub:  h,
 		conn: conn,
 		send: make(chan []byte, 256),
+		mode: mode,
+	}
+
+	// Reconnecting clients pass the last revision they applied with
+	// /ws?epoch=...&since=...
+	if since := query.Get("since"); since != "" {
+		if revision, err := strconv.ParseUint(since, 10, 64); err == nil {
+			client.resume = true
+			client.epoch = query.Get("epoch")
+			client.revision = revision
+		}
 	}
 
-	client.hub.register <- client
+	select {
+	case h.register <- client:
+	case <-h.done:
+		// The hub is stopped, nobody would serve the client
+		conn.Close()
+		return
+	}
 
 	go client.writePump()
 	go client.readPump()
@@ -206,11 +508,14 @@ func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		select {
+		case c.hub.unregister <- c:
+		case <-c.hub.done:
+		}
 		c.conn.Close()
 	}()
 
-	c.conn.SetReadLimit(512)
+	c.conn.SetReadLimit(maxMessageSize)
 	c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
 	c.conn.SetPongHandler(func(string) error {
 		c.conn.SetReadDeadline(time.Now().Add(60 * time.Second))
@@ -218,13 +523,20 @@ func (c *Client) readPump() {
 	})
 
 	for {
-		_, _, err := c.conn.ReadMessage()
+		_, data, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
 				log.Printf("WebSocket error: %v", err)
 			}
 			break
 		}
+
+		if err := c.handleMessage(data); err != nil {
+			log.Printf("Rejected client message: %v", err)
+			c.hub.do(func() {
+				c.hub.sendError(c, "", err)
+			})
+		}
 	}
 }
 
@@ -265,13 +577,25 @@ func (c *Client) writePump() {
 
 // ResetDeltaTracker resets the delta tracker state
 func (h *Hub) ResetDeltaTracker() {
-	h.deltaTracker.Reset()
-	log.Printf("Delta tracker reset")
+	if h.do(h.deltaTracker.Reset) {
+		log.Printf("Delta tracker reset")
+	}
 }
 
 // GetDeltaStats returns delta tracker statistics
 func (h *Hub) GetDeltaStats() map[string]int {
-	stats := h.deltaTracker.GetStats()
-	stats["connected_clients"] = len(h.clients)
+	stats := map[string]int{}
+	h.do(func() {
+		stats = h.deltaTracker.GetStats()
+		stats["connected_clients"] = len(h.clients)
+		stats["lagging_clients"] = 0
+		for client := range h.clients {
+			if client.lagging {
+				stats["lagging_clients"]++
+			}
+		}
+		stats["dropped_updates"] = h.droppedUpdates
+		stats["resyncs"] = h.resyncs
+	})
 	return stats
 }
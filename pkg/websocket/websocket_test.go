@@ -0,0 +1,312 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/afritzler/kube-universe/pkg/delta"
+	kutype "github.com/afritzler/kube-universe/pkg/types"
+	"github.com/gorilla/websocket"
+)
+
+// fakeSource stands in for the renderer cache. Tests set the graph it builds
+// and signal changes like the cache's informers would.
+type fakeSource struct {
+	mu        sync.Mutex
+	podStatus string
+	cpuUsage  string
+	changes   chan struct{}
+}
+
+func newFakeSource(podStatus string) *fakeSource {
+	return &fakeSource{podStatus: podStatus, changes: make(chan struct{}, 1)}
+}
+
+func (f *fakeSource) BuildGraph() *kutype.Graph {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	nodes := []kutype.Node{
+		{Id: "namespace/default", Name: "default", Type: "namespace"},
+		{Id: "pod/default/web-0", Name: "web-0", Type: "pod", Namespace: "default", Status: f.podStatus,
+			Labels: map[string]string{"app": "web"}, ResourceInfo: map[string]interface{}{"cpu_usage": f.cpuUsage}},
+	}
+	links := []kutype.Link{
+		{Source: "namespace/default", Target: "pod/default/web-0", Value: 1, Relationship: "contains"},
+	}
+	return &kutype.Graph{Nodes: &nodes, Links: &links}
+}
+
+func (f *fakeSource) Changes() <-chan struct{} {
+	return f.changes
+}
+
+// setPodStatus changes the graph and notifies the hub
+func (f *fakeSource) setPodStatus(status string) {
+	f.mu.Lock()
+	f.podStatus = status
+	f.mu.Unlock()
+	f.notify()
+}
+
+// setUsage changes the pod's usage like a metrics poll and notifies the hub
+func (f *fakeSource) setUsage(cpu string) {
+	f.mu.Lock()
+	f.cpuUsage = cpu
+	f.mu.Unlock()
+	f.notify()
+}
+
+func (f *fakeSource) notify() {
+	select {
+	case f.changes <- struct{}{}:
+	default:
+	}
+}
+
+// startHub runs a hub until the test ends
+func startHub(t *testing.T, source graphSource, config HubConfig) *Hub {
+	t.Helper()
+	h := newHub(source, config)
+	go h.Run()
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := h.Stop(ctx); err != nil {
+			t.Errorf("Stop failed: %s", err)
+		}
+	})
+	return h
+}
+
+// dial connects a websocket client to the hub, query is appended to /ws
+func dial(t *testing.T, h *Hub, query string) *websocket.Conn {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(h.HandleWebSocket))
+	t.Cleanup(server.Close)
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + "/ws" + query
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+func readUpdate(t *testing.T, conn *websocket.Conn) *delta.DeltaUpdate {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var update delta.DeltaUpdate
+	if err := conn.ReadJSON(&update); err != nil {
+		t.Fatalf("failed to read update: %s", err)
+	}
+	return &update
+}
+
+// waitForStats polls the hub's stats until done accepts them
+func waitForStats(t *testing.T, h *Hub, what string, done func(stats map[string]int) bool) map[string]int {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		stats := h.GetDeltaStats()
+		if done(stats) {
+			return stats
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s, stats are %v", what, stats)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHubBroadcastsUpdates(t *testing.T) {
+	source := newFakeSource("Running")
+	h := startHub(t, source, HubConfig{CoalesceWindow: 10 * time.Millisecond, HistorySize: 10})
+
+	conn := dial(t, h, "")
+	full := readUpdate(t, conn)
+	if full.Type != "full" || len(full.Nodes) != 2 || len(full.Links) != 1 {
+		t.Fatalf("expected a full update of the graph, got %+v", full)
+	}
+	for _, node := range full.Nodes {
+		if node.Labels != nil {
+			t.Errorf("update carries labels of %s, nodes should be slim", node.Id)
+		}
+	}
+	if stats := h.GetDeltaStats(); stats["connected_clients"] != 1 {
+		t.Errorf("connected_clients = %d, want 1", stats["connected_clients"])
+	}
+
+	source.setPodStatus("Failed")
+	update := readUpdate(t, conn)
+	if update.Type != "delta" || update.BaseRevision != full.Revision || update.Epoch != full.Epoch {
+		t.Fatalf("expected a delta on revision %d, got %+v", full.Revision, update)
+	}
+	if len(update.Nodes) != 1 || update.Nodes[0].Status != "Failed" {
+		t.Errorf("expected the failed pod in the delta, got %+v", update.Nodes)
+	}
+
+	// A reconnecting client only gets what it missed, as a patch in
+	// merge-patch mode
+	resumed := dial(t, h, fmt.Sprintf("?mode=%s&epoch=%s&since=%d", delta.ModeMergePatch, full.Epoch, full.Revision))
+	missed := readUpdate(t, resumed)
+	if missed.Type != "delta" || missed.Revision != update.Revision {
+		t.Fatalf("expected the missed delta at revision %d, got %+v", update.Revision, missed)
+	}
+	if len(missed.NodePatches) != 1 || missed.NodePatches[0].Id != "pod/default/web-0" || len(missed.Nodes) != 0 {
+		t.Errorf("expected a patch of the pod, got nodes %+v and patches %+v", missed.Nodes, missed.NodePatches)
+	}
+	waitForStats(t, h, "the second client", func(stats map[string]int) bool {
+		return stats["connected_clients"] == 2
+	})
+
+	conn.Close()
+	waitForStats(t, h, "the first client to disconnect", func(stats map[string]int) bool {
+		return stats["connected_clients"] == 1
+	})
+
+	// The remaining client still gets updates
+	source.setPodStatus("Running")
+	if update := readUpdate(t, resumed); update.Type != "delta" || update.BaseRevision != missed.Revision {
+		t.Errorf("expected a delta on revision %d, got %+v", missed.Revision, update)
+	}
+}
+
+func TestHubPushesUsage(t *testing.T) {
+	tests := []struct {
+		name   string
+		config HubConfig
+	}{
+		{
+			name:   "usage not ignored",
+			config: HubConfig{CoalesceWindow: 10 * time.Millisecond},
+		},
+		{
+			name: "usage ignored",
+			config: HubConfig{
+				CoalesceWindow:       10 * time.Millisecond,
+				PollInterval:         20 * time.Millisecond,
+				IgnoredFields:        []string{"resourceinfo.cpu_usage*"},
+				IgnoredFieldsMaxHold: 100 * time.Millisecond,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			source := newFakeSource("Running")
+			source.cpuUsage = "100m"
+			h := startHub(t, source, tt.config)
+			conn := dial(t, h, "")
+			full := readUpdate(t, conn)
+
+			source.setUsage("250m")
+			update := readUpdate(t, conn)
+			if update.Type != "delta" || update.BaseRevision != full.Revision {
+				t.Fatalf("expected a delta on revision %d, got %+v", full.Revision, update)
+			}
+			if len(update.Nodes) != 1 || update.Nodes[0].ResourceInfo["cpu_usage"] != "250m" {
+				t.Errorf("expected the pod with its new usage, got %+v", update.Nodes)
+			}
+		})
+	}
+}
+
+func TestHubStop(t *testing.T) {
+	h := newHub(newFakeSource("Running"), HubConfig{CoalesceWindow: 10 * time.Millisecond})
+	go h.Run()
+
+	conn := dial(t, h, "")
+	readUpdate(t, conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := h.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %s", err)
+	}
+	if err := h.Stop(ctx); err != nil {
+		t.Errorf("second Stop failed: %s", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseNoStatusReceived) {
+		t.Errorf("expected the hub to close the connection, got %v", err)
+	}
+	if stats := h.GetDeltaStats(); len(stats) != 0 {
+		t.Errorf("stopped hub returned stats %v", stats)
+	}
+	if node := h.NodeDetails("pod/default/web-0"); node != nil {
+		t.Errorf("stopped hub returned node %+v", node)
+	}
+
+	// Clients connecting afterwards are turned away
+	late := dial(t, h, "")
+	late.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, _, err := late.ReadMessage(); err == nil {
+		t.Errorf("stopped hub served a new client")
+	}
+}
+
+func TestHubStopTimeout(t *testing.T) {
+	// Run never started, so Stop can only return when ctx is done
+	h := newHub(newFakeSource("Running"), HubConfig{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := h.Stop(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Stop = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestHubResyncsSlowClients(t *testing.T) {
+	source := newFakeSource("Running")
+	h := startHub(t, source, HubConfig{CoalesceWindow: time.Millisecond})
+
+	// Without pumps nothing drains the buffer, the initial update fills it
+	client := &Client{hub: h, send: make(chan []byte, 1), mode: delta.ModeFull}
+	h.register <- client
+	if stats := h.GetDeltaStats(); stats["connected_clients"] != 1 || len(client.send) != 1 {
+		t.Fatalf("expected the client to get its initial update, stats are %v", stats)
+	}
+
+	source.setPodStatus("Pending")
+	waitForStats(t, h, "the client to lag", func(stats map[string]int) bool {
+		return stats["lagging_clients"] == 1 && stats["dropped_updates"] == 1
+	})
+
+	// Lagging clients miss updates even if there is room
+	<-client.send
+	source.setPodStatus("Failed")
+	waitForStats(t, h, "the second update to be dropped", func(stats map[string]int) bool {
+		return stats["dropped_updates"] == 2
+	})
+
+	// Once caught up, the client gets one full update of the latest graph
+	stats := waitForStats(t, h, "the client to be resynced", func(stats map[string]int) bool {
+		return stats["resyncs"] == 1
+	})
+	if stats["lagging_clients"] != 0 {
+		t.Errorf("lagging_clients = %d after the resync, want 0", stats["lagging_clients"])
+	}
+	var update delta.DeltaUpdate
+	select {
+	case message := <-client.send:
+		if err := json.Unmarshal(message, &update); err != nil {
+			t.Fatalf("failed to decode update: %s", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("resynced client got no update")
+	}
+	if update.Type != "full" || update.Revision != uint64(stats["revision"]) {
+		t.Errorf("expected a full update at revision %d, got %+v", stats["revision"], update)
+	}
+	for _, node := range update.Nodes {
+		if node.Type == "pod" && node.Status != "Failed" {
+			t.Errorf("resync carries pod status %q, want Failed", node.Status)
+		}
+	}
+}
@@ -9,12 +9,21 @@ let isInitialized = false;
 
 // WebSocket variables
 const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-const wsUrl = `${protocol}//${window.location.host}/ws`;
+// Changed nodes arrive as JSON Merge Patches to save bandwidth
+const wsUrl = `${protocol}//${window.location.host}/ws?mode=merge-patch`;
 const statusDiv = document.getElementById('connection-status');
 let ws;
 let reconnectInterval = 1000;
 const maxReconnectInterval = 30000;
 let currentData = { nodes: [], links: [] };
+// Last applied graph revision, sent on reconnect to only receive missed updates
+let lastEpoch = null;
+let lastRevision = null;
+// Server-side subscription, null receives the whole cluster
+let activeSubscription = null;
+// Node details requested over the websocket, by request id
+const pendingDetails = new Map();
+let nextDetailsRequest = 1;
 
 // Performance monitoring
 let updateStats = {
@@ -29,8 +38,8 @@ let updateStats = {
 const filterPresets = {
   network: {
     name: 'Network Constellation View',
-    resourceTypes: ['domain', 'pod', 'service', 'ingress', 'endpointslice', 'namespace'],
-    relationshipTypes: ['exposes', 'routes', 'depends_on', 'contains', 'accesses']
+    resourceTypes: ['domain', 'pod', 'service', 'ingress', 'gatewayclass', 'gateway', 'httproute', 'grpcroute', 'endpointslice', 'networkpolicy', 'namespace'],
+    relationshipTypes: ['exposes', 'routes', 'depends_on', 'contains', 'accesses', 'applies_to', 'allows_ingress_from', 'allows_egress_to']
   },
   namespace: {
     name: 'Namespace Bulbs',
@@ -39,7 +48,7 @@ const filterPresets = {
   },
   workload: {
     name: 'Workload View',
-    resourceTypes: ['pod', 'deployment', 'replicaset', 'daemonset', 'statefulset', 'node'],
+    resourceTypes: ['pod', 'deployment', 'replicaset', 'daemonset', 'statefulset', 'job', 'cronjob', 'node'],
     relationshipTypes: ['manages', 'instance_of', 'runs']
   },
   storage: {
@@ -176,7 +185,23 @@ function logUpdatePerformance(updateType, startTime, details = {}) {
 }
 
 // Sidebar functionality
+let sidebarNodeId = null;
+
+// Updates only carry slim nodes, show what we have and fill in labels,
+// annotations and the remaining resource details once they arrive
 function showResourceDetails(node) {
+  sidebarNodeId = node.id;
+  renderResourceDetails(node);
+  requestNodeDetails(node.id)
+    .then(details => {
+      if (sidebarNodeId === node.id) {
+        renderResourceDetails(details);
+      }
+    })
+    .catch(error => console.warn(`Failed to load details of ${node.id}:`, error));
+}
+
+function renderResourceDetails(node) {
   const sidebar = document.getElementById('sidebar');
   const resourceName = document.getElementById('sidebar-resource-name');
   const resourceType = document.getElementById('sidebar-resource-type');
@@ -197,8 +222,8 @@ function showResourceDetails(node) {
   if (node.namespace) {
     content += `<div class="sidebar-item"><span class="sidebar-label">Namespace:</span><span class="sidebar-value">${node.namespace}</span></div>`;
   }
-  if (node.age) {
-    content += `<div class="sidebar-item"><span class="sidebar-label">Age:</span><span class="sidebar-value">${node.age}</span></div>`;
+  if (node.creationtime) {
+    content += `<div class="sidebar-item"><span class="sidebar-label">Age:</span><span class="sidebar-value">${formatAge(node.creationtime)}</span></div>`;
   }
   if (node.creationtime) {
     const date = new Date(node.creationtime);
@@ -228,7 +253,7 @@ function showResourceDetails(node) {
     content += '<div class="sidebar-section-title">Resource Details</div>';
     
     Object.entries(node.resourceinfo).forEach(([key, value]) => {
-      if (key === 'key_names' && Array.isArray(value)) {
+      if ((key === 'key_names' || key === 'binary_key_names' || key === 'unused_keys') && Array.isArray(value)) {
         content += `<div class="sidebar-item"><span class="sidebar-label">${formatLabel(key)}:</span><div class="sidebar-labels">`;
         value.forEach(keyName => {
           content += `<span class="sidebar-label-item">${keyName}</span>`;
@@ -291,6 +316,7 @@ function showResourceDetails(node) {
 }
 
 function closeSidebar() {
+  sidebarNodeId = null;
   const sidebar = document.getElementById('sidebar');
   sidebar.classList.remove('open');
   
@@ -56,6 +56,18 @@ function initializeGraph() {
   }
 }
 
+// Derive a human-readable age from a creation timestamp, the server only sends the timestamp
+function formatAge(creationTime) {
+  const created = new Date(creationTime);
+  if (isNaN(created.getTime()) || created.getFullYear() <= 1) return 'Unknown';
+
+  const seconds = Math.max(0, (Date.now() - created.getTime()) / 1000);
+  if (seconds < 60) return `${Math.round(seconds)}s`;
+  if (seconds < 3600) return `${Math.round(seconds / 60)}m`;
+  if (seconds < 86400) return `${Math.round(seconds / 3600)}h`;
+  return `${Math.round(seconds / 86400)}d`;
+}
+
 // Create node tooltip
 function createNodeTooltip(n) {
   let tooltip = `<div style="background: rgba(0,0,0,0.9); color: white; padding: 12px; border-radius: 8px; font-family: 'Courier New', monospace; font-size: 12px; max-width: 400px; line-height: 1.4;">`;
@@ -69,8 +81,8 @@ function createNodeTooltip(n) {
     tooltip += `<div style="margin-bottom: 4px;"><span style="color: #99ff66;">Namespace:</span> ${n.namespace}</div>`;
   }
   
-  if (n.age) {
-    tooltip += `<div style="margin-bottom: 4px;"><span style="color: #99ff66;">Age:</span> ${n.age}</div>`;
+  if (n.creationtime) {
+    tooltip += `<div style="margin-bottom: 4px;"><span style="color: #99ff66;">Age:</span> ${formatAge(n.creationtime)}</div>`;
   }
   
   if (n.status) {
@@ -90,20 +102,6 @@ function createNodeTooltip(n) {
     tooltip += `</div>`;
   }
   
-  // Labels (show first few)
-  if (n.labels && Object.keys(n.labels).length > 0) {
-    tooltip += `<div style="border-top: 1px solid #444; margin-top: 8px; padding-top: 8px;">`;
-    tooltip += `<div style="color: #ffcc66; margin-bottom: 4px;">Labels:</div>`;
-    const labelEntries = Object.entries(n.labels).slice(0, 3);
-    labelEntries.forEach(([key, value]) => {
-      tooltip += `<div style="font-size: 11px; color: #ccc; margin-left: 8px;">${key}: ${value}</div>`;
-    });
-    if (Object.keys(n.labels).length > 3) {
-      tooltip += `<div style="font-size: 11px; color: #888; margin-left: 8px;">... and ${Object.keys(n.labels).length - 3} more</div>`;
-    }
-    tooltip += `</div>`;
-  }
-  
   tooltip += `</div>`;
   return tooltip;
 }
@@ -119,6 +117,11 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.node_name) info += `<div><span style="color: #cc66ff;">Node:</span> ${n.resourceinfo.node_name}</div>`;
     if (n.resourceinfo.pod_ip) info += `<div><span style="color: #cc66ff;">Pod IP:</span> ${n.resourceinfo.pod_ip}</div>`;
     if (n.resourceinfo.qos_class) info += `<div><span style="color: #cc66ff;">QoS:</span> ${n.resourceinfo.qos_class}</div>`;
+    if (n.resourceinfo.cpu_requests !== undefined) info += `<div><span style="color: #cc66ff;">CPU:</span> ${n.resourceinfo.cpu_requests} / ${n.resourceinfo.cpu_limits} (req/limit)</div>`;
+    if (n.resourceinfo.memory_requests !== undefined) info += `<div><span style="color: #cc66ff;">Memory:</span> ${n.resourceinfo.memory_requests} / ${n.resourceinfo.memory_limits} (req/limit)</div>`;
+    if (n.resourceinfo.cpu_usage) info += `<div><span style="color: #cc66ff;">CPU Usage:</span> ${n.resourceinfo.cpu_usage}${n.resourceinfo.cpu_usage_percent_of_request !== undefined ? ` (${n.resourceinfo.cpu_usage_percent_of_request}% of request)` : ''}</div>`;
+    if (n.resourceinfo.memory_usage) info += `<div><span style="color: #cc66ff;">Memory Usage:</span> ${n.resourceinfo.memory_usage}${n.resourceinfo.memory_usage_percent_of_request !== undefined ? ` (${n.resourceinfo.memory_usage_percent_of_request}% of request)` : ''}</div>`;
+    if (n.resourceinfo.unrestricted) info += `<div><span style="color: #cc66ff;">Network:</span> <span style="color: #ff4444;">Unrestricted</span></div>`;
   }
   
   // Node-specific info
@@ -126,6 +129,11 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.cpu_capacity) info += `<div><span style="color: #cc66ff;">CPU:</span> ${n.resourceinfo.cpu_capacity}</div>`;
     if (n.resourceinfo.memory_capacity) info += `<div><span style="color: #cc66ff;">Memory:</span> ${n.resourceinfo.memory_capacity}</div>`;
     if (n.resourceinfo.storage_capacity) info += `<div><span style="color: #cc66ff;">Storage:</span> ${n.resourceinfo.storage_capacity}</div>`;
+    if (n.resourceinfo.cpu_requests !== undefined) info += `<div><span style="color: #cc66ff;">CPU Requested:</span> ${n.resourceinfo.cpu_requests} of ${n.resourceinfo.cpu_allocatable} (${n.resourceinfo.cpu_requests_percent}%)</div>`;
+    if (n.resourceinfo.memory_requests !== undefined) info += `<div><span style="color: #cc66ff;">Memory Requested:</span> ${n.resourceinfo.memory_requests} of ${n.resourceinfo.memory_allocatable} (${n.resourceinfo.memory_requests_percent}%)</div>`;
+    if (n.resourceinfo.cpu_usage) info += `<div><span style="color: #cc66ff;">CPU Usage:</span> ${n.resourceinfo.cpu_usage} (${n.resourceinfo.cpu_usage_percent_of_allocatable}%)</div>`;
+    if (n.resourceinfo.memory_usage) info += `<div><span style="color: #cc66ff;">Memory Usage:</span> ${n.resourceinfo.memory_usage} (${n.resourceinfo.memory_usage_percent_of_allocatable}%)</div>`;
+    if (n.resourceinfo.overcommitted) info += `<div><span style="color: #cc66ff;">Limits:</span> <span style="color: #ff4444;">Overcommitted</span></div>`;
     if (n.resourceinfo.os_image) info += `<div><span style="color: #cc66ff;">OS:</span> ${n.resourceinfo.os_image}</div>`;
     if (n.resourceinfo.kernel_version) info += `<div><span style="color: #cc66ff;">Kernel:</span> ${n.resourceinfo.kernel_version}</div>`;
   }
@@ -148,6 +156,9 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.key_names && n.resourceinfo.key_names.length > 0) {
       info += `<div><span style="color: #cc66ff;">Keys:</span> ${n.resourceinfo.key_names.slice(0, 5).join(', ')}${n.resourceinfo.key_names.length > 5 ? '...' : ''}</div>`;
     }
+    if (n.resourceinfo.unused_keys && n.resourceinfo.unused_keys.length > 0) {
+      info += `<div><span style="color: #cc66ff;">Unused Keys:</span> ${n.resourceinfo.unused_keys.slice(0, 5).join(', ')}${n.resourceinfo.unused_keys.length > 5 ? '...' : ''}</div>`;
+    }
   }
   
   // Secret-specific info
@@ -158,6 +169,9 @@ function getResourceSpecificInfo(n) {
       const sizeKB = Math.round(n.resourceinfo.total_size_bytes / 1024);
       info += `<div><span style="color: #cc66ff;">Size:</span> ${sizeKB} KB</div>`;
     }
+    if (n.resourceinfo.unused_keys && n.resourceinfo.unused_keys.length > 0) {
+      info += `<div><span style="color: #cc66ff;">Unused Keys:</span> ${n.resourceinfo.unused_keys.slice(0, 5).join(', ')}${n.resourceinfo.unused_keys.length > 5 ? '...' : ''}</div>`;
+    }
   }
   
   // Deployment/ReplicaSet/StatefulSet info
@@ -174,6 +188,20 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.number_available !== undefined) info += `<div><span style="color: #cc66ff;">Available:</span> ${n.resourceinfo.number_available}</div>`;
   }
   
+  // Job info
+  if (n.type === 'job') {
+    if (n.resourceinfo.completions !== undefined) info += `<div><span style="color: #cc66ff;">Completions:</span> ${n.resourceinfo.completions}</div>`;
+    if (n.resourceinfo.succeeded !== undefined) info += `<div><span style="color: #cc66ff;">Succeeded:</span> ${n.resourceinfo.succeeded}</div>`;
+    if (n.resourceinfo.failed !== undefined) info += `<div><span style="color: #cc66ff;">Failed:</span> ${n.resourceinfo.failed}</div>`;
+  }
+  
+  // CronJob info
+  if (n.type === 'cronjob') {
+    if (n.resourceinfo.schedule) info += `<div><span style="color: #cc66ff;">Schedule:</span> ${n.resourceinfo.schedule}</div>`;
+    if (n.resourceinfo.suspend !== undefined) info += `<div><span style="color: #cc66ff;">Suspended:</span> ${n.resourceinfo.suspend}</div>`;
+    if (n.resourceinfo.last_schedule_time) info += `<div><span style="color: #cc66ff;">Last Schedule:</span> ${n.resourceinfo.last_schedule_time}</div>`;
+  }
+  
   // Ingress info
   if (n.type === 'ingress') {
     if (n.resourceinfo.rules) info += `<div><span style="color: #cc66ff;">Rules:</span> ${n.resourceinfo.rules}</div>`;
@@ -181,6 +209,31 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.ingress_class) info += `<div><span style="color: #cc66ff;">Class:</span> ${n.resourceinfo.ingress_class}</div>`;
   }
   
+  // Gateway API info
+  if (n.type === 'gatewayclass') {
+    if (n.resourceinfo.controller_name) info += `<div><span style="color: #cc66ff;">Controller:</span> ${n.resourceinfo.controller_name}</div>`;
+  }
+  if (n.type === 'gateway') {
+    if (n.resourceinfo.gateway_class) info += `<div><span style="color: #cc66ff;">Class:</span> ${n.resourceinfo.gateway_class}</div>`;
+    if (n.resourceinfo.listeners !== undefined) info += `<div><span style="color: #cc66ff;">Listeners:</span> ${n.resourceinfo.listeners}</div>`;
+    if (n.resourceinfo.addresses) info += `<div><span style="color: #cc66ff;">Addresses:</span> ${n.resourceinfo.addresses.join(', ')}</div>`;
+  }
+  if (n.type === 'httproute' || n.type === 'grpcroute') {
+    if (n.resourceinfo.hostnames && n.resourceinfo.hostnames.length > 0) info += `<div><span style="color: #cc66ff;">Hostnames:</span> ${n.resourceinfo.hostnames.join(', ')}</div>`;
+    if (n.resourceinfo.rules !== undefined) info += `<div><span style="color: #cc66ff;">Rules:</span> ${n.resourceinfo.rules}</div>`;
+    if (n.resourceinfo.backends !== undefined) info += `<div><span style="color: #cc66ff;">Backends:</span> ${n.resourceinfo.backends}</div>`;
+  }
+  
+  // NetworkPolicy info
+  if (n.type === 'networkpolicy') {
+    if (n.resourceinfo.pod_selector) info += `<div><span style="color: #cc66ff;">Pod Selector:</span> ${n.resourceinfo.pod_selector}</div>`;
+    if (n.resourceinfo.policy_types) info += `<div><span style="color: #cc66ff;">Policy Types:</span> ${n.resourceinfo.policy_types.join(', ')}</div>`;
+    if (n.resourceinfo.ingress_rules !== undefined) info += `<div><span style="color: #cc66ff;">Ingress Rules:</span> ${n.resourceinfo.ingress_rules}</div>`;
+    if (n.resourceinfo.egress_rules !== undefined) info += `<div><span style="color: #cc66ff;">Egress Rules:</span> ${n.resourceinfo.egress_rules}</div>`;
+    if (n.resourceinfo.allows_all_ingress) info += `<div><span style="color: #cc66ff;">Ingress:</span> allows all sources</div>`;
+    if (n.resourceinfo.allows_all_egress) info += `<div><span style="color: #cc66ff;">Egress:</span> allows all destinations</div>`;
+  }
+  
   // EndpointSlice info
   if (n.type === 'endpointslice') {
     if (n.resourceinfo.endpoints) info += `<div><span style="color: #cc66ff;">Endpoints:</span> ${n.resourceinfo.endpoints}</div>`;
@@ -193,6 +246,19 @@ function getResourceSpecificInfo(n) {
     if (n.resourceinfo.image_pull_secrets) info += `<div><span style="color: #cc66ff;">Image Pull Secrets:</span> ${n.resourceinfo.image_pull_secrets}</div>`;
   }
   
+  // Role/ClusterRole info
+  if (n.type === 'role' || n.type === 'clusterrole') {
+    if (n.resourceinfo.rules !== undefined) info += `<div><span style="color: #cc66ff;">Rules:</span> ${n.resourceinfo.rules}</div>`;
+    if (n.resourceinfo.wildcard) info += `<div><span style="color: #cc66ff;">Wildcard:</span> <span style="color: #ff4444;">yes</span></div>`;
+    if (n.resourceinfo.escalation) info += `<div><span style="color: #cc66ff;">Escalation:</span> <span style="color: #ff4444;">yes</span></div>`;
+  }
+  
+  // RoleBinding/ClusterRoleBinding info
+  if (n.type === 'rolebinding' || n.type === 'clusterrolebinding') {
+    if (n.resourceinfo.role_ref) info += `<div><span style="color: #cc66ff;">Role:</span> ${n.resourceinfo.role_ref}</div>`;
+    if (n.resourceinfo.subjects) info += `<div><span style="color: #cc66ff;">Subjects:</span> ${n.resourceinfo.subjects.length}</div>`;
+  }
+  
   // PersistentVolume info
   if (n.type === 'persistentvolume') {
     if (n.resourceinfo.capacity) info += `<div><span style="color: #cc66ff;">Capacity:</span> ${n.resourceinfo.capacity}</div>`;
@@ -222,6 +288,8 @@ function getNodeColor(n) {
     return '#66ccff'; // Bright cyan for namespaces
   } else if (n.type == "domain") {
     return '#ff9900'; // Bright orange for domains
+  } else if (n.type == "externalowner") {
+    return '#999999'; // Grey for owners that are not collected
   } else if (n.type == "pod") {
     if (n.status === "Running") return '#44ff44'; // Bright green for running
     if (n.status === "Failed") return '#ff4444'; // Bright red for failed
@@ -232,8 +300,18 @@ function getNodeColor(n) {
     return '#ff66cc'; // Bright magenta for services
   } else if (n.type == "ingress") {
     return '#ffcc66'; // Bright yellow for ingresses
+  } else if (n.type == "gatewayclass") {
+    return '#ffe066'; // Pale yellow for gateway classes
+  } else if (n.type == "gateway") {
+    return '#ffb366'; // Bright apricot for gateways
+  } else if (n.type == "httproute") {
+    return '#66e0ff'; // Bright sky for HTTP routes
+  } else if (n.type == "grpcroute") {
+    return '#66ffe0'; // Bright aqua for gRPC routes
   } else if (n.type == "endpointslice") {
     return '#cc66ff'; // Bright purple for endpoint slices
+  } else if (n.type == "networkpolicy") {
+    return '#ff4488'; // Bright rose for network policies
   } else if (n.type == "serviceaccount") {
     return '#66ffcc'; // Bright teal for service accounts
   } else if (n.type == "deployment") {
@@ -244,6 +322,22 @@ function getNodeColor(n) {
     return '#6699ff'; // Bright sky blue for daemon sets
   } else if (n.type == "statefulset") {
     return '#ff6699'; // Bright pink for stateful sets
+  } else if (n.type == "job") {
+    return '#ffdd44'; // Bright gold for jobs
+  } else if (n.type == "cronjob") {
+    return '#ffaa88'; // Bright peach for cron jobs
+  } else if (n.type == "role") {
+    return '#ffbb33'; // Bright amber for roles
+  } else if (n.type == "clusterrole") {
+    return '#ff8800'; // Bright orange for cluster roles
+  } else if (n.type == "rolebinding") {
+    return '#bb88ff'; // Bright lavender for role bindings
+  } else if (n.type == "clusterrolebinding") {
+    return '#8855ff'; // Bright violet for cluster role bindings
+  } else if (n.type == "user") {
+    return '#eeeeee'; // Light grey for users
+  } else if (n.type == "group") {
+    return '#aaccee'; // Pale blue for groups
   } else if (n.type == "configmap") {
     return '#ccff66'; // Bright yellow-green for config maps
   } else if (n.type == "secret") {
@@ -351,6 +445,54 @@ function createNodeObject(n) {
     }))
     return createNodeWithLabel(mesh, n.name, n.type, -18);
   }
+  if (n.type == "gatewayclass") {
+    // Pale yellow cone for gateway classes
+    var mesh = new THREE.Mesh(
+      new THREE.ConeGeometry(12, 10),
+      new THREE.MeshPhongMaterial({
+        color: 0xffe066,
+        emissive: 0x443a11,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -17);
+  }
+  if (n.type == "gateway") {
+    // Bright apricot cone for gateways
+    var mesh = new THREE.Mesh(
+      new THREE.ConeGeometry(10, 16),
+      new THREE.MeshPhongMaterial({
+        color: 0xffb366,
+        emissive: 0x442e11,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -18);
+  }
+  if (n.type == "httproute") {
+    // Bright sky octahedron for HTTP routes
+    var mesh = new THREE.Mesh(
+      new THREE.OctahedronGeometry(7),
+      new THREE.MeshPhongMaterial({
+        color: 0x66e0ff,
+        emissive: 0x113a44,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -13);
+  }
+  if (n.type == "grpcroute") {
+    // Bright aqua octahedron for gRPC routes
+    var mesh = new THREE.Mesh(
+      new THREE.OctahedronGeometry(7),
+      new THREE.MeshPhongMaterial({
+        color: 0x66ffe0,
+        emissive: 0x11443a,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -13);
+  }
   if (n.type == "endpointslice") {
     // Bright purple octahedron for endpoint slices
     var mesh = new THREE.Mesh(
@@ -363,6 +505,18 @@ function createNodeObject(n) {
     }))
     return createNodeWithLabel(mesh, n.name, n.type, -12);
   }
+  if (n.type == "networkpolicy") {
+    // Bright rose octahedron for network policies
+    var mesh = new THREE.Mesh(
+      new THREE.OctahedronGeometry(9),
+      new THREE.MeshPhongMaterial({
+        color: 0xff4488,
+        emissive: 0x441122,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -16);
+  }
   if (n.type == "serviceaccount") {
     // Bright teal tetrahedron for service accounts
     var mesh = new THREE.Mesh(
@@ -423,6 +577,102 @@ function createNodeObject(n) {
     }))
     return createNodeWithLabel(mesh, n.name, n.type, -18);
   }
+  if (n.type == "job") {
+    // Bright gold icosahedron for jobs
+    var mesh = new THREE.Mesh(
+      new THREE.IcosahedronGeometry(8),
+      new THREE.MeshPhongMaterial({
+        color: 0xffdd44,
+        emissive: 0x443311,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -15);
+  }
+  if (n.type == "cronjob") {
+    // Bright peach ring for cron jobs
+    var mesh = new THREE.Mesh(
+      new THREE.TorusGeometry(8, 2),
+      new THREE.MeshPhongMaterial({
+        color: 0xffaa88,
+        emissive: 0x442211,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -15);
+  }
+  if (n.type == "role") {
+    // Bright amber box for roles
+    var mesh = new THREE.Mesh(
+      new THREE.BoxGeometry(9,9,9),
+      new THREE.MeshPhongMaterial({
+        color: 0xffbb33,
+        emissive: 0x443311,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -14);
+  }
+  if (n.type == "clusterrole") {
+    // Bright orange box for cluster roles
+    var mesh = new THREE.Mesh(
+      new THREE.BoxGeometry(12,12,12),
+      new THREE.MeshPhongMaterial({
+        color: 0xff8800,
+        emissive: 0x442200,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -16);
+  }
+  if (n.type == "rolebinding") {
+    // Bright lavender tetrahedron for role bindings
+    var mesh = new THREE.Mesh(
+      new THREE.TetrahedronGeometry(7),
+      new THREE.MeshPhongMaterial({
+        color: 0xbb88ff,
+        emissive: 0x332244,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -13);
+  }
+  if (n.type == "clusterrolebinding") {
+    // Bright violet tetrahedron for cluster role bindings
+    var mesh = new THREE.Mesh(
+      new THREE.TetrahedronGeometry(9),
+      new THREE.MeshPhongMaterial({
+        color: 0x8855ff,
+        emissive: 0x221144,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -15);
+  }
+  if (n.type == "user") {
+    // Light grey sphere for users
+    var mesh = new THREE.Mesh(
+      new THREE.SphereGeometry(6),
+      new THREE.MeshPhongMaterial({
+        color: 0xeeeeee,
+        emissive: 0x333333,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -12);
+  }
+  if (n.type == "group") {
+    // Pale blue dodecahedron for groups
+    var mesh = new THREE.Mesh(
+      new THREE.DodecahedronGeometry(7),
+      new THREE.MeshPhongMaterial({
+        color: 0xaaccee,
+        emissive: 0x223344,
+        transparent: false,
+        opacity: 1
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -13);
+  }
   if (n.type == "configmap") {
     // Bright yellow-green for config maps
     var mesh = new THREE.Mesh(
@@ -472,6 +722,19 @@ function createNodeObject(n) {
     return createNodeWithLabel(mesh, n.name, n.type, -14);
   }
   
+  if (n.type == "externalowner") {
+    // Grey translucent sphere for owners that are not collected
+    var mesh = new THREE.Mesh(
+      new THREE.SphereGeometry(7),
+      new THREE.MeshPhongMaterial({
+        color: 0x999999,
+        emissive: 0x222222,
+        transparent: true,
+        opacity: 0.6
+    }))
+    return createNodeWithLabel(mesh, n.name, n.type, -14);
+  }
+  
   // Default sphere for other types
   var mesh = new THREE.Mesh(
     new THREE.SphereGeometry(8),
@@ -496,6 +759,11 @@ function getLinkColor(link) {
     case 'runs': return '#6699ff';           // Blue for running on
     case 'accesses': return '#cc66ff';       // Purple for access
     case 'claims': return '#44aaff';         // Blue for PVC claiming PV
+    case 'applies_to': return '#ff4488';     // Rose for network policy targets
+    case 'allows_ingress_from': return '#44ffaa'; // Mint for allowed ingress
+    case 'allows_egress_to': return '#ffaa44';    // Amber for allowed egress
+    case 'binds_to': return '#bb88ff';       // Lavender for binding subjects
+    case 'grants': return '#ff8800';         // Orange for granted roles
     default: return '#66ccff';               // Default cyan
   }
 }
@@ -513,6 +781,10 @@ function getLinkOpacity(link) {
     case 'accesses': return 0.9;     // High opacity for access
     case 'claims': return 0.8;       // Standard opacity for claims
     case 'binds_to': return 0.8;     // Standard opacity for binds
+    case 'grants': return 0.8;       // Standard opacity for grants
+    case 'applies_to': return 0.8;   // Standard opacity for policy targets
+    case 'allows_ingress_from': return 0.7; // Lower opacity for allowed traffic
+    case 'allows_egress_to': return 0.7;    // Lower opacity for allowed traffic
     default: return 0.8;             // Default opacity
   }
 }
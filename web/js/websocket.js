@@ -2,12 +2,17 @@
 
 function connectWebSocket() {
   updateStatus('Connecting...', '#FFC107');
-  ws = new WebSocket(wsUrl);
+  // Resume from the last applied revision if we have one
+  const url = lastRevision !== null ? `${wsUrl}&epoch=${encodeURIComponent(lastEpoch)}&since=${lastRevision}` : wsUrl;
+  ws = new WebSocket(url);
   
   ws.onopen = function() {
     console.log('WebSocket connected');
     updateStatus('Connected (Live)', '#4CAF50');
     reconnectInterval = 1000; // Reset reconnect interval on successful connection
+    if (activeSubscription) {
+      ws.send(JSON.stringify({ type: 'subscribe', subscription: activeSubscription }));
+    }
   };
   
   ws.onmessage = function(event) {
@@ -15,6 +20,24 @@ function connectWebSocket() {
       const data = JSON.parse(event.data);
       const timestamp = new Date().toLocaleTimeString();
       
+      if (data.type === 'details' || (data.type === 'error' && data.request_id)) {
+        const pending = pendingDetails.get(data.request_id);
+        if (pending) {
+          pendingDetails.delete(data.request_id);
+          if (data.type === 'details') {
+            pending.resolve(data.node);
+          } else {
+            pending.reject(new Error(data.message));
+          }
+        }
+        return;
+      }
+      
+      if (data.type === 'error') {
+        console.warn('Server rejected message:', data.message);
+        return;
+      }
+      
       // Hide loading overlay and show rendering dialog on first data received
       if (!isInitialized) {
         hideLoadingOverlay();
@@ -22,10 +45,29 @@ function connectWebSocket() {
         // Don't set isInitialized here - let updateGraphData handle it
       }
       
+      // Skip deltas we already have, e.g. ones included in the snapshot we resumed from
+      if (data.type === 'delta' && data.epoch === lastEpoch && lastRevision !== null && data.revision <= lastRevision) {
+        return;
+      }
+      
+      // A delta for another revision means we missed an update, reconnect to catch up
+      if (data.type === 'delta' && (data.epoch !== lastEpoch || data.base_revision !== lastRevision)) {
+        console.warn(`Missed updates (have revision ${lastRevision}, delta applies to ${data.base_revision}), resyncing`);
+        if (data.epoch !== lastEpoch) lastRevision = null;
+        ws.close();
+        return;
+      }
+      
+      if (data.revision !== undefined) {
+        lastEpoch = data.epoch;
+        lastRevision = data.revision;
+      }
+      
       // Handle different message types
       if (data.type === 'delta') {
         console.log(`[${timestamp}] Received delta:`, {
           nodes: data.nodes?.length || 0,
+          nodePatches: data.node_patches?.length || 0,
           links: data.links?.length || 0,
           removedNodes: data.removed_nodes?.length || 0,
           removedLinks: data.removed_links?.length || 0
@@ -34,7 +76,12 @@ function connectWebSocket() {
       } else {
         // Backward compatibility: treat as full update if no type specified
         console.log(`[${timestamp}] Received full data:`, data.nodes?.length, 'nodes,', data.links?.length, 'links');
-        updateGraphData(data);
+        // A subscription may match nothing, empty lists are omitted
+        updateGraphData({ ...data, nodes: data.nodes || [], links: data.links || [] });
+      }
+      
+      if (data.checksum) {
+        verifyChecksum(data.checksum, data.revision);
       }
       
       updateStatus(`Connected (Live) - ${timestamp}`, '#4CAF50');
@@ -45,6 +92,9 @@ function connectWebSocket() {
   };
   
   ws.onclose = function() {
+    // Answers to pending details requests are lost with the connection
+    pendingDetails.forEach(pending => pending.reject(new Error('connection closed')));
+    pendingDetails.clear();
     console.log('WebSocket disconnected, attempting to reconnect...');
     updateStatus('Reconnecting...', '#FF9800');
     setTimeout(connectWebSocket, reconnectInterval);
@@ -87,7 +137,9 @@ function applyDeltaUpdate(deltaData) {
   
   logUpdatePerformance('delta', startTime, {
     nodes: deltaData.nodes?.length || 0,
+    nodePatches: deltaData.node_patches?.length || 0,
     links: deltaData.links?.length || 0,
+    updatedLinks: deltaData.updated_links?.length || 0,
     removedNodes: deltaData.removed_nodes?.length || 0,
     removedLinks: deltaData.removed_links?.length || 0,
     filteredNodes: filteredData.nodes.length,
@@ -115,10 +167,16 @@ function applyDeltaToOriginalData(deltaData) {
   
   // Remove specific links
   if (deltaData.removed_links && deltaData.removed_links.length > 0) {
-    const removedLinkKeys = new Set(deltaData.removed_links.map(l => `${l.source}-${l.target}`));
-    updatedData.links = updatedData.links.filter(l => {
-      const linkKey = `${l.source}-${l.target}`;
-      return !removedLinkKeys.has(linkKey);
+    const removedLinkKeys = new Set(deltaData.removed_links.map(linkKey));
+    updatedData.links = updatedData.links.filter(l => !removedLinkKeys.has(linkKey(l)));
+  }
+  
+  // Update changed links
+  if (deltaData.updated_links && deltaData.updated_links.length > 0) {
+    const updatedLinks = new Map(deltaData.updated_links.map(l => [linkKey(l), l]));
+    updatedData.links = updatedData.links.map(l => {
+      const updatedLink = updatedLinks.get(linkKey(l));
+      return updatedLink ? { ...updatedLink } : l;
     });
   }
   
@@ -138,13 +196,24 @@ function applyDeltaToOriginalData(deltaData) {
     });
   }
   
+  // Patch changed nodes
+  if (deltaData.node_patches && deltaData.node_patches.length > 0) {
+    const nodeMap = new Map(updatedData.nodes.map(n => [n.id, n]));
+    
+    deltaData.node_patches.forEach(({ id, patch }) => {
+      const existingNode = nodeMap.get(id);
+      if (existingNode) {
+        applyMergePatch(existingNode, patch);
+      }
+    });
+  }
+  
   // Add new links
   if (deltaData.links && deltaData.links.length > 0) {
-    const existingLinkKeys = new Set(updatedData.links.map(l => `${l.source}-${l.target}`));
+    const existingLinkKeys = new Set(updatedData.links.map(linkKey));
     
     deltaData.links.forEach(newLink => {
-      const linkKey = `${newLink.source}-${newLink.target}`;
-      if (!existingLinkKeys.has(linkKey)) {
+      if (!existingLinkKeys.has(linkKey(newLink))) {
         updatedData.links.push(newLink);
       }
     });
@@ -188,21 +257,28 @@ function applyDeltaToGraph(deltaData, filteredData) {
   
   // Remove specific links
   if (deltaData.removed_links && deltaData.removed_links.length > 0) {
-    const removedLinkKeys = new Set(deltaData.removed_links.map(l => `${l.source}-${l.target}`));
+    const removedLinkKeys = new Set(deltaData.removed_links.map(linkKey));
     
     for (let i = currentLinks.length - 1; i >= 0; i--) {
-      const link = currentLinks[i];
-      const sourceId = link.source.id || link.source;
-      const targetId = link.target.id || link.target;
-      const linkKey = `${sourceId}-${targetId}`;
-      
-      if (removedLinkKeys.has(linkKey)) {
+      if (removedLinkKeys.has(linkKey(currentLinks[i]))) {
         currentLinks.splice(i, 1);
         graphChanged = true;
       }
     }
   }
   
+  // Update changed links in place
+  if (deltaData.updated_links && deltaData.updated_links.length > 0) {
+    const updatedLinks = new Map(deltaData.updated_links.map(l => [linkKey(l), l]));
+    currentLinks.forEach(link => {
+      const updatedLink = updatedLinks.get(linkKey(link));
+      if (updatedLink) {
+        updateLinkAttributes(link, updatedLink);
+        graphChanged = true;
+      }
+    });
+  }
+  
   // Add or update nodes (only if they pass the filter)
   if (deltaData.nodes && deltaData.nodes.length > 0) {
     const filteredNodeIds = new Set(filteredData.nodes.map(n => n.id));
@@ -224,22 +300,32 @@ function applyDeltaToGraph(deltaData, filteredData) {
     });
   }
   
+  // Patch changed nodes, adding those that now pass the filter
+  if (deltaData.node_patches && deltaData.node_patches.length > 0) {
+    const filteredNodeMap = new Map(filteredData.nodes.map(n => [n.id, n]));
+    const currentNodeMap = new Map(currentNodes.map(n => [n.id, n]));
+    
+    deltaData.node_patches.forEach(({ id, patch }) => {
+      const existingNode = currentNodeMap.get(id);
+      if (existingNode) {
+        applyMergePatch(existingNode, patch);
+      } else if (filteredNodeMap.has(id)) {
+        currentNodes.push(filteredNodeMap.get(id));
+        graphChanged = true;
+      }
+    });
+  }
+  
   // Add new links (only if both nodes are visible)
   if (deltaData.links && deltaData.links.length > 0) {
     const visibleNodeIds = new Set(currentNodes.map(n => n.id));
-    const existingLinkKeys = new Set(currentLinks.map(l => {
-      const sourceId = l.source.id || l.source;
-      const targetId = l.target.id || l.target;
-      return `${sourceId}-${targetId}`;
-    }));
+    const existingLinkKeys = new Set(currentLinks.map(linkKey));
     
     deltaData.links.forEach(newLink => {
-      const linkKey = `${newLink.source}-${newLink.target}`;
-      
       // Only add if both nodes are visible and link doesn't exist
       if (visibleNodeIds.has(newLink.source) && 
           visibleNodeIds.has(newLink.target) && 
-          !existingLinkKeys.has(linkKey) &&
+          !existingLinkKeys.has(linkKey(newLink)) &&
           !hiddenRelationshipTypes.has(newLink.relationship)) {
         currentLinks.push(newLink);
         graphChanged = true;
@@ -312,6 +398,124 @@ function updateGraphData(newData) {
   performIncrementalUpdate(filteredData);
 }
 
+// Limit what the server sends, e.g. subscribe({ namespaces: ['default'], node_types: ['pod'] }).
+// Subscriptions also accept relationships and a label_selector, null goes back to the whole cluster.
+function subscribe(subscription) {
+  activeSubscription = subscription;
+  if (ws && ws.readyState === WebSocket.OPEN) {
+    ws.send(JSON.stringify(subscription ? { type: 'subscribe', subscription } : { type: 'unsubscribe' }));
+  }
+}
+
+// Full details of a node, over the websocket if it is connected
+function requestNodeDetails(id) {
+  if (!ws || ws.readyState !== WebSocket.OPEN) {
+    return fetch(`/nodes/${id}`).then(response => {
+      if (!response.ok) throw new Error(`HTTP ${response.status}`);
+      return response.json();
+    });
+  }
+  const requestId = String(nextDetailsRequest++);
+  return new Promise((resolve, reject) => {
+    pendingDetails.set(requestId, { resolve, reject });
+    ws.send(JSON.stringify({ type: 'details', id, request_id: requestId }));
+  });
+}
+
+// Fields the server hashes, the graph library adds its own to nodes and links
+const checksumNodeFields = ['id', 'namespace', 'name', 'type', 'status', 'statusmessage', 'creationtime', 'labels', 'annotations', 'resourceinfo'];
+const checksumLinkFields = ['source', 'target', 'value', 'relationship', 'consumption', 'keys'];
+
+// JSON with sorted object keys, matching the server's canonical encoding
+function canonicalJSON(value) {
+  if (Array.isArray(value)) return `[${value.map(canonicalJSON).join(',')}]`;
+  if (value !== null && typeof value === 'object') {
+    return `{${Object.keys(value).sort().map(k => `${JSON.stringify(k)}:${canonicalJSON(value[k])}`).join(',')}}`;
+  }
+  return JSON.stringify(value);
+}
+
+async function sha256Hex(text) {
+  const hash = await crypto.subtle.digest('SHA-256', new TextEncoder().encode(text));
+  return Array.from(new Uint8Array(hash)).map(b => b.toString(16).padStart(2, '0')).join('');
+}
+
+function pickFields(obj, fields) {
+  const picked = {};
+  fields.forEach(field => {
+    let value = obj[field];
+    if (value !== undefined) {
+      if ((field === 'source' || field === 'target') && typeof value === 'object') value = value.id;
+      picked[field] = value;
+    }
+  });
+  return picked;
+}
+
+// Checksum of the graph as the server computes it, independent of node and link order
+async function graphChecksum(data) {
+  const nodeDigests = await Promise.all(data.nodes.map(n => sha256Hex(canonicalJSON(pickFields(n, checksumNodeFields)))));
+  const linkDigests = await Promise.all(data.links.map(l => sha256Hex(canonicalJSON(pickFields(l, checksumLinkFields)))));
+  nodeDigests.sort();
+  linkDigests.sort();
+  let text = 'nodes\n';
+  nodeDigests.forEach(d => { text += d + '\n'; });
+  text += 'links\n';
+  linkDigests.forEach(d => { text += d + '\n'; });
+  return sha256Hex(text);
+}
+
+// Compare our graph with the server's and ask for a full update if they drifted apart
+async function verifyChecksum(expected, revision) {
+  // WebCrypto is only available in secure contexts
+  if (!window.crypto || !crypto.subtle) return;
+  
+  const actual = await graphChecksum(originalData);
+  // Another update arrived in the meantime, it is verified on its own
+  if (revision !== lastRevision) return;
+  if (actual !== expected) {
+    console.warn(`Graph checksum mismatch at revision ${revision}, requesting resync`);
+    if (ws && ws.readyState === WebSocket.OPEN) {
+      ws.send(JSON.stringify({ type: 'resync' }));
+    }
+  }
+}
+
+// Apply an RFC 7386 JSON Merge Patch in place, so the graph keeps its node objects
+function applyMergePatch(target, patch) {
+  Object.entries(patch).forEach(([key, value]) => {
+    if (value === null) {
+      delete target[key];
+    } else if (typeof value === 'object' && !Array.isArray(value)) {
+      if (typeof target[key] !== 'object' || target[key] === null || Array.isArray(target[key])) {
+        target[key] = {};
+      }
+      applyMergePatch(target[key], value);
+    } else {
+      target[key] = value;
+    }
+  });
+  return target;
+}
+
+// Key links by both ends and their relationship without a separator that could appear in node ids
+function linkKey(link) {
+  return JSON.stringify([link.source.id || link.source, link.target.id || link.target, link.relationship || '']);
+}
+
+// Copy changed link attributes without replacing the resolved source and target nodes
+function updateLinkAttributes(existingLink, updatedLink) {
+  Object.entries(updatedLink).forEach(([key, value]) => {
+    if (key !== 'source' && key !== 'target') {
+      existingLink[key] = value;
+    }
+  });
+  // Attributes left out of the update were cleared
+  ['consumption', 'keys'].forEach(key => {
+    if (!(key in updatedLink)) delete existingLink[key];
+  });
+}
+
 function performIncrementalUpdate(newFilteredData) {
   const startTime = performance.now();
   
@@ -325,8 +529,8 @@ function performIncrementalUpdate(newFilteredData) {
   // Create maps for efficient lookups
   const currentNodeMap = new Map(currentNodes.map(n => [n.id, n]));
   const newNodeMap = new Map(newNodes.map(n => [n.id, n]));
-  const currentLinkMap = new Map(currentLinks.map(l => [`${l.source.id || l.source}-${l.target.id || l.target}`, l]));
-  const newLinkMap = new Map(newLinks.map(l => [`${l.source}-${l.target}`, l]));
+  const currentLinkMap = new Map(currentLinks.map(l => [linkKey(l), l]));
+  const newLinkMap = new Map(newLinks.map(l => [linkKey(l), l]));
 
   // Track changes
   const nodesToAdd = [];
@@ -356,18 +560,14 @@ function performIncrementalUpdate(newFilteredData) {
 
   // Find links to add
   newLinks.forEach(newLink => {
-    const linkKey = `${newLink.source}-${newLink.target}`;
-    if (!currentLinkMap.has(linkKey)) {
+    if (!currentLinkMap.has(linkKey(newLink))) {
       linksToAdd.push(newLink);
     }
   });
 
   // Find links to remove
   currentLinks.forEach(currentLink => {
-    const sourceId = currentLink.source.id || currentLink.source;
-    const targetId = currentLink.target.id || currentLink.target;
-    const linkKey = `${sourceId}-${targetId}`;
-    if (!newLinkMap.has(linkKey)) {
+    if (!newLinkMap.has(linkKey(currentLink))) {
       linksToRemove.push(currentLink);
     }
   });
@@ -404,13 +604,8 @@ function performIncrementalUpdate(newFilteredData) {
 
       // Remove links
       linksToRemove.forEach(linkToRemove => {
-        const sourceId = linkToRemove.source.id || linkToRemove.source;
-        const targetId = linkToRemove.target.id || linkToRemove.target;
-        const linkIndex = updatedLinks.findIndex(l => {
-          const lSourceId = l.source.id || l.source;
-          const lTargetId = l.target.id || l.target;
-          return lSourceId === sourceId && lTargetId === targetId;
-        });
+        const key = linkKey(linkToRemove);
+        const linkIndex = updatedLinks.findIndex(l => linkKey(l) === key);
         if (linkIndex !== -1) {
           updatedLinks.splice(linkIndex, 1);
         }